@@ -17,6 +17,7 @@ limitations under the License.
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"github.com/Dentrax/xdsl-exporter/internal/rtop"
 	"net/http"
@@ -29,9 +30,9 @@ import (
 	"github.com/Dentrax/xdsl-exporter/internal/config"
 	"github.com/Dentrax/xdsl-exporter/internal/dsl"
 	"github.com/Dentrax/xdsl-exporter/internal/exporter"
+	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/promlog"
 	"github.com/prometheus/common/version"
 	"github.com/prometheus/exporter-toolkit/web"
@@ -55,6 +56,13 @@ var (
 	}
 )
 
+// collectorFlags and noCollectorFlags hold the --collector.<name> and
+// --no-collector.<name> flags of every collector.
+var (
+	collectorFlags   = make(map[string]*bool)
+	noCollectorFlags = make(map[string]*bool)
+)
+
 func Execute() {
 	if err := cmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -65,16 +73,42 @@ func Execute() {
 func init() {
 	cobra.OnInitialize(initConfig)
 
+	cmd.PersistentFlags().StringVar(&cfgFile, "config", "", "Path to the config file (default is $HOME/.xdsl-exporter.yaml)")
 	cmd.PersistentFlags().StringVar(&cfg.ListenAddress, "listen-address", ":9090", "Address on which to expose metrics and web interface.")
 	cmd.PersistentFlags().StringVar(&cfg.MetricsPath, "metrics-path", "/metrics", "Path under which to expose metrics.")
+	cmd.PersistentFlags().StringVar(&cfg.ProbePath, "probe-path", "/probe", "Path under which to expose the multi-target probe endpoint.")
+	cmd.PersistentFlags().DurationVar(&cfg.ProbeIdleTimeout, "probe-idle-timeout", 15*time.Minute, "Time after which the session to a probed target that is no longer probed is closed; 0 keeps it open")
+	cmd.PersistentFlags().IntVar(&cfg.ProbeMaxTargets, "probe-max-targets", 100, "Maximum number of probed targets whose session is kept open; 0 is unlimited")
+	cmd.PersistentFlags().StringVar(&cfg.Namespace, "namespace", exporter.Namespace, "Namespace of all metrics")
+	cmd.PersistentFlags().StringToStringVar(&cfg.Labels, "label", nil, "Constant label to add to all metrics, as name=value; can be repeated")
 	cmd.PersistentFlags().StringVar(&cfg.KnownHostsPath, "known-hosts-path", "~/.ssh/known_hosts", "Path to your known_hosts file.")
 	cmd.PersistentFlags().StringVar(&cfg.TargetHost, "target-host", "192.168.1.1", "Hostname or IP address of the target xDSL Modem")
-	cmd.PersistentFlags().IntVar(&cfg.TargetPort, "target-port", 22, "Port of the target xDSL Modem")
+	cmd.PersistentFlags().IntVar(&cfg.TargetPort, "target-port", 0, "Port of the target xDSL Modem; 0 uses the default port of the client")
 	cmd.PersistentFlags().StringVar(&cfg.TargetUser, "target-user", "admin", "Host user")
 	cmd.PersistentFlags().StringVar(&cfg.TargetPassword, "target-password", "", "Host password")
 	cmd.PersistentFlags().StringVar(&cfg.TargetSSHKeyPath, "target-ssh-key-path", "", "Path to the SSH key to use for authentication")
 	cmd.PersistentFlags().StringVar(&cfg.TargetSSHPassphrase, "target-ssh-passphrase", "", "Passphrase to use for the SSH key")
 	cmd.PersistentFlags().StringVar(&cfg.TargetClient, "target-client", "", strings.Join(dsl.GetSupportedClients(), ","))
+	cmd.PersistentFlags().Int64Var(&cfg.TargetContract.Downstream, "target-contract-downstream", 0, "Contracted downstream rate of the target in bit/s")
+	cmd.PersistentFlags().Int64Var(&cfg.TargetContract.Upstream, "target-contract-upstream", 0, "Contracted upstream rate of the target in bit/s")
+	cmd.PersistentFlags().Int64Var(&cfg.TargetContract.MinimumDownstream, "target-contract-minimum-downstream", 0, "Minimum guaranteed downstream rate of the target in bit/s")
+	cmd.PersistentFlags().Int64Var(&cfg.TargetContract.MinimumUpstream, "target-contract-minimum-upstream", 0, "Minimum guaranteed upstream rate of the target in bit/s")
+	cmd.PersistentFlags().DurationVar(&cfg.ReconnectMinBackoff, "reconnect-min-backoff", time.Second, "Minimum delay before reconnecting to the target after the session is dropped")
+	cmd.PersistentFlags().DurationVar(&cfg.ReconnectMaxBackoff, "reconnect-max-backoff", 5*time.Minute, "Maximum delay between reconnect attempts to the target")
+	cmd.PersistentFlags().DurationVar(&cfg.PollInterval, "poll-interval", 0, "Interval at which the target is polled in the background; 0 polls on every scrape")
+	cmd.PersistentFlags().DurationVar(&cfg.MaxStaleness, "max-staleness", 5*time.Minute, "Maximum age of data polled in the background before its series are dropped; 0 never drops")
+	cmd.PersistentFlags().DurationVar(&cfg.ScrapeTimeoutOffset, "scrape-timeout-offset", 500*time.Millisecond, "Offset to subtract from the timeout announced by Prometheus")
+	cmd.PersistentFlags().DurationVar(&cfg.DslTimeout, "dsl-timeout", 10*time.Second, "Maximum time to wait for the DSL status of the target; 0 waits for the scrape timeout")
+	cmd.PersistentFlags().IntVar(&cfg.RtopPort, "rtop-port", 22, "SSH port of the target used to collect the system stats")
+	cmd.PersistentFlags().DurationVar(&cfg.RtopTimeout, "rtop-timeout", 10*time.Second, "Maximum time to wait for the system stats of the target; 0 waits for the scrape timeout")
+	cmd.PersistentFlags().IntVar(&cfg.DslBinsGroupSize, "dsl-bins-group-size", 16, "Number of tones averaged into each series of the per-tone metrics")
+	cmd.PersistentFlags().BoolVar(&cfg.LegacyMetrics, "legacy-metrics", false, "Also expose the deprecated metrics with a unit label that were replaced by metrics in base units")
+	cmd.PersistentFlags().DurationVar(&cfg.CoalesceWindow, "coalesce-window", 5*time.Second, "Window after a poll in which further scrapes share its result; 0 only shares polls in flight")
+
+	for _, name := range exporter.CollectorNames() {
+		collectorFlags[name] = cmd.PersistentFlags().Bool("collector."+name, exporter.CollectorEnabledByDefault(name), fmt.Sprintf("Enable the %s collector", name))
+		noCollectorFlags[name] = cmd.PersistentFlags().Bool("no-collector."+name, false, fmt.Sprintf("Disable the %s collector", name))
+	}
 }
 
 func initConfig() {
@@ -92,6 +126,70 @@ func initConfig() {
 	viper.AutomaticEnv()
 	if err := viper.ReadInConfig(); err == nil {
 		fmt.Println("Using config file:", viper.ConfigFileUsed())
+	} else if cfgFile != "" {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// The flags take precedence over the config file.
+	if ns := viper.GetString("namespace"); ns != "" && !cmd.PersistentFlags().Changed("namespace") {
+		cfg.Namespace = ns
+	}
+
+	labels := make(map[string]string)
+	if err := viper.UnmarshalKey("labels", &labels); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for name, value := range cfg.Labels {
+		labels[name] = value
+	}
+	cfg.Labels = labels
+
+	collectors := make(map[string]bool)
+	if err := viper.UnmarshalKey("collectors", &collectors); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for name := range collectors {
+		if _, ok := collectorFlags[name]; !ok {
+			fmt.Printf("unknown collector %q, valid collectors are %s\n", name, strings.Join(exporter.CollectorNames(), ", "))
+			os.Exit(1)
+		}
+	}
+	for name, enabled := range collectorFlags {
+		if cmd.PersistentFlags().Changed("collector." + name) {
+			collectors[name] = *enabled
+		}
+		if *noCollectorFlags[name] {
+			collectors[name] = false
+		}
+	}
+	cfg.Collectors = collectors
+
+	if err := viper.UnmarshalKey("filter", &cfg.Filter); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if err := viper.UnmarshalKey("raw_data", &cfg.RawDataRules); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if err := viper.UnmarshalKey("commands", &cfg.Commands); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if err := viper.UnmarshalKey("modules", &cfg.Modules); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if err := viper.UnmarshalKey("targets", &cfg.Targets); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 }
 
@@ -108,20 +206,40 @@ func run() error {
 		return fmt.Errorf("config check: %w", err)
 	}
 
-	dslClient, err := dsl.New(cfg)
-	if err != nil {
-		return err
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The targets of the config file take precedence over the target given by
+	// the flags, which is optional when only probing modules.
+	targets := cfg.TargetConfigs()
+	if len(targets) == 0 && cfg.TargetClient != "" {
+		targets = append(targets, cfg)
 	}
 
-	rtopClient, err := rtop.New(cfg)
-	if err != nil {
-		return err
+	exporters := make([]*exporter.Exporter, 0, len(targets))
+	for _, target := range targets {
+		dslClient, err := dsl.New(target)
+		if err != nil {
+			return fmt.Errorf("target %q: %w", target.TargetName, err)
+		}
+
+		rtopClient := rtop.New(target)
+
+		targetLogger := logger
+		if target.TargetName != "" {
+			targetLogger = log.With(logger, "target", target.TargetName)
+		}
+
+		e := exporter.New(target, dslClient, rtopClient, targetLogger)
+		go e.Poll(ctx)
+
+		exporters = append(exporters, e)
 	}
 
-	exporter := exporter.New(dslClient, rtopClient, logger)
-	prometheus.MustRegister(exporter)
+	probeHandler := exporter.NewProbeHandler(cfg, logger)
 
-	http.Handle(cfg.MetricsPath, promhttp.Handler())
+	http.Handle(cfg.MetricsPath, exporter.NewHandler(exporters, cfg.ScrapeTimeoutOffset, logger))
+	http.Handle(cfg.ProbePath, probeHandler)
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(`
             	<html>
@@ -150,7 +268,11 @@ func run() error {
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 		<-c
-		exporter.CloseClient()
+		cancel()
+		for _, e := range exporters {
+			e.CloseClient()
+		}
+		probeHandler.Close()
 		close(done)
 	}()
 
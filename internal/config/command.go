@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Formats of the output of commands.
+const (
+	CommandFormatRegex      = "regex"
+	CommandFormatPrometheus = "prometheus"
+)
+
+// Command is a read-only shell command that is run on the modem over the SSH
+// connection of rtop. Its output is either parsed in the Prometheus text
+// format or mapped into metrics by regex rules. A command that does not finish
+// within its timeout is abandoned; the timeout of rtop is used if it is zero.
+type Command struct {
+	Name    string        `mapstructure:"name"`
+	Command string        `mapstructure:"command"`
+	Format  string        `mapstructure:"format"`
+	Timeout time.Duration `mapstructure:"timeout"`
+	Rules   []RegexRule   `mapstructure:"rules"`
+}
+
+func (c Command) check() []error {
+	var errs []error
+
+	if c.Command == "" {
+		errs = append(errs, fmt.Errorf("command is empty"))
+	}
+
+	if c.Timeout < 0 {
+		errs = append(errs, fmt.Errorf("timeout must not be negative"))
+	}
+
+	switch c.Format {
+	case "", CommandFormatRegex:
+		if len(c.Rules) == 0 {
+			errs = append(errs, fmt.Errorf("no rules for the regex format"))
+		}
+	case CommandFormatPrometheus:
+		if len(c.Rules) > 0 {
+			errs = append(errs, fmt.Errorf("rules are not used by the prometheus format"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("invalid format %q", c.Format))
+	}
+
+	return errs
+}
+
+func checkCommands(commands []Command) []error {
+	var (
+		errs  []error
+		rules []RegexRule
+	)
+
+	names := make(map[string]bool, len(commands))
+	for i, command := range commands {
+		name := command.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+			errs = append(errs, fmt.Errorf("command %q: name is empty", name))
+		}
+		if names[name] {
+			errs = append(errs, fmt.Errorf("command %q: duplicate name", name))
+		}
+		names[name] = true
+
+		for _, err := range command.check() {
+			errs = append(errs, fmt.Errorf("command %q: %w", name, err))
+		}
+		rules = append(rules, command.Rules...)
+	}
+
+	// The rules of all commands share the namespace of their metrics.
+	for _, err := range checkRules(rules) {
+		errs = append(errs, fmt.Errorf("commands: %w", err))
+	}
+
+	return errs
+}
@@ -4,14 +4,18 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
+	"github.com/prometheus/common/model"
 )
 
 type Config struct {
 	ListenAddress       string
 	MetricsPath         string
 	KnownHostsPath      string
+	TargetName          string
 	TargetHost          string
 	TargetPort          int
 	TargetUser          string
@@ -19,38 +23,254 @@ type Config struct {
 	TargetSSHKeyPath    string
 	TargetSSHPassphrase string
 	TargetClient        string
+	TargetOptions       map[string]string
+	TargetLabels        map[string]string
+	TargetContract      Contract
+	RtopDisabled        bool
+	RtopPort            int
+	RtopUser            string
+	RtopSSHKeyPath      string
+	ProbePath           string
+	ProbeIdleTimeout    time.Duration
+	ProbeMaxTargets     int
+	Modules             map[string]Module
+	Targets             []Target
+	ReconnectMinBackoff time.Duration
+	ReconnectMaxBackoff time.Duration
+	PollInterval        time.Duration
+	MaxStaleness        time.Duration
+	ScrapeTimeoutOffset time.Duration
+	DslTimeout          time.Duration
+	RtopTimeout         time.Duration
+	CoalesceWindow      time.Duration
+	DslBinsGroupSize    int
+	LegacyMetrics       bool
+	Namespace           string
+	Labels              map[string]string
+	// Collectors enables or disables collectors by name; the others keep
+	// their default.
+	Collectors map[string]bool
+	Filter     Filter
+	// RawDataRules extract metrics from the raw data of the DSL modem.
+	RawDataRules []RegexRule
+	// Commands are run on the modem to collect further metrics.
+	Commands []Command
 }
 
+// Errors collects every problem found while checking the config.
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Check validates the whole config, including every module and target, and
+// reports all problems at once.
 func (c Config) Check() error {
+	var errs Errors
+
 	if c.ListenAddress == "" {
-		return fmt.Errorf("listen address is empty")
+		errs = append(errs, fmt.Errorf("listen address is empty"))
 	}
 
 	if c.MetricsPath == "" {
-		return fmt.Errorf("metrics path is empty")
+		errs = append(errs, fmt.Errorf("metrics path is empty"))
+	}
+
+	if c.ProbePath == "" {
+		errs = append(errs, fmt.Errorf("probe path is empty"))
+	}
+
+	if c.Namespace != "" && !model.IsValidMetricName(model.LabelValue(c.Namespace)) {
+		errs = append(errs, fmt.Errorf("invalid namespace %q", c.Namespace))
+	}
+
+	errs = append(errs, checkConstLabels(c.Labels)...)
+	errs = append(errs, c.Filter.check()...)
+
+	for _, err := range checkRules(c.RawDataRules) {
+		errs = append(errs, fmt.Errorf("raw data: %w", err))
+	}
+
+	errs = append(errs, checkCommands(c.Commands)...)
+
+	if c.TargetClient == "" && len(c.Modules) == 0 && len(c.Targets) == 0 {
+		errs = append(errs, fmt.Errorf("target client is empty and no modules or targets are configured"))
+	}
+
+	if c.TargetClient != "" && len(c.Targets) == 0 {
+		errs = append(errs, c.checkTarget()...)
+		errs = append(errs, c.TargetContract.check()...)
+	}
+
+	for name, module := range c.Modules {
+		for _, err := range c.ForModule(c.TargetHost, module).checkCredentials() {
+			errs = append(errs, fmt.Errorf("module %q: %w", name, err))
+		}
+		if _, err := module.Targets.Compile(); err != nil {
+			errs = append(errs, fmt.Errorf("module %q: targets: %w", name, err))
+		}
+	}
+
+	names := make(map[string]bool, len(c.Targets))
+	for i, target := range c.Targets {
+		tc := c.ForTarget(target)
+
+		name := tc.TargetName
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		if names[name] {
+			errs = append(errs, fmt.Errorf("target %q: duplicate name", name))
+		}
+		names[name] = true
+
+		for _, err := range tc.checkTarget() {
+			errs = append(errs, fmt.Errorf("target %q: %w", name, err))
+		}
+		for _, err := range checkConstLabels(target.Labels) {
+			errs = append(errs, fmt.Errorf("target %q: %w", name, err))
+		}
+		for _, err := range tc.TargetContract.check() {
+			errs = append(errs, fmt.Errorf("target %q: %w", name, err))
+		}
+	}
+
+	if c.ReconnectMinBackoff <= 0 {
+		errs = append(errs, fmt.Errorf("reconnect min backoff must be positive"))
+	}
+
+	if c.ReconnectMaxBackoff < c.ReconnectMinBackoff {
+		errs = append(errs, fmt.Errorf("reconnect max backoff is less than min backoff"))
+	}
+
+	if c.PollInterval < 0 {
+		errs = append(errs, fmt.Errorf("poll interval is negative"))
+	}
+
+	if c.MaxStaleness < 0 {
+		errs = append(errs, fmt.Errorf("max staleness is negative"))
+	}
+
+	if c.ScrapeTimeoutOffset < 0 {
+		errs = append(errs, fmt.Errorf("scrape timeout offset is negative"))
+	}
+
+	if c.DslTimeout < 0 || c.RtopTimeout < 0 {
+		errs = append(errs, fmt.Errorf("collector timeout is negative"))
+	}
+
+	if c.ProbeIdleTimeout < 0 {
+		errs = append(errs, fmt.Errorf("probe idle timeout is negative"))
+	}
+
+	if c.ProbeMaxTargets < 0 {
+		errs = append(errs, fmt.Errorf("probe max targets is negative"))
+	}
+
+	if c.CoalesceWindow < 0 {
+		errs = append(errs, fmt.Errorf("coalesce window is negative"))
+	}
+
+	if c.Collectors["dsl_bins"] && c.DslBinsGroupSize <= 0 {
+		errs = append(errs, fmt.Errorf("bins group size must be positive"))
 	}
 
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (c Config) checkTarget() []error {
+	var errs []error
+
 	if c.TargetHost == "" {
-		return fmt.Errorf("target host is empty")
+		errs = append(errs, fmt.Errorf("target host is empty"))
+	} else if _, err := url.Parse(c.TargetHost); err != nil {
+		errs = append(errs, fmt.Errorf("invalid target host: %w", err))
 	}
 
-	_, err := url.Parse(c.TargetHost)
-	if err != nil {
-		return fmt.Errorf("invalid target host: %w", err)
+	return append(errs, c.checkCredentials()...)
+}
+
+func (c Config) checkCredentials() []error {
+	var errs []error
+
+	if c.TargetClient == "" {
+		errs = append(errs, fmt.Errorf("target client is empty"))
 	}
 
 	if c.TargetUser == "" {
-		return fmt.Errorf("target user is empty")
+		errs = append(errs, fmt.Errorf("target user is empty"))
 	}
 
 	if c.TargetPassword == "" && c.TargetSSHKeyPath == "" {
-		return fmt.Errorf("no password or ssh key path provided")
+		errs = append(errs, fmt.Errorf("no password or ssh key path provided"))
 	}
 
-	return nil
+	return errs
+}
+
+// variableLabels are the names of the labels that the metrics of the exporter
+// set themselves, which constant labels must not repeat.
+var variableLabels = map[string]bool{
+	"band":      true,
+	"class":     true,
+	"collector": true,
+	"direction": true,
+	"hostname":  true,
+	"interface": true,
+	"ipv4":      true,
+	"ipv6":      true,
+	"metric":    true,
+	"mode":      true,
+	"mount":     true,
+	"state":     true,
+	"tone":      true,
+	"unit":      true,
+	"vendor":    true,
+	"version":   true,
+}
+
+// checkConstLabels checks the constant labels added to every metric.
+func checkConstLabels(labels map[string]string) []error {
+	errs := checkLabels(labels)
+
+	for name := range labels {
+		if variableLabels[name] {
+			errs = append(errs, fmt.Errorf("label %q is used by the metrics of the exporter", name))
+		}
+	}
+
+	return errs
+}
+
+func checkLabels(labels map[string]string) []error {
+	var errs []error
+
+	for name := range labels {
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			errs = append(errs, fmt.Errorf("invalid label name %q", name))
+		}
+		if name == TargetLabel {
+			errs = append(errs, fmt.Errorf("label %q is reserved", name))
+		}
+	}
+
+	return errs
 }
 
 func (c Config) ReadSSHKey() (string, error) {
+	if c.TargetSSHKeyPath == "" {
+		return "", nil
+	}
+
 	value, err := os.ReadFile(c.TargetSSHKeyPath)
 	if err != nil {
 		return "", fmt.Errorf("read ssh key: %w", err)
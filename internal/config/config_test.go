@@ -0,0 +1,223 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func validConfig() Config {
+	return Config{
+		ListenAddress:       ":9090",
+		MetricsPath:         "/metrics",
+		ProbePath:           "/probe",
+		TargetHost:          "192.168.1.1",
+		TargetUser:          "admin",
+		TargetPassword:      "secret",
+		TargetClient:        "Broadcom (SSH)",
+		ReconnectMinBackoff: time.Second,
+		ReconnectMaxBackoff: time.Minute,
+		DslBinsGroupSize:    16,
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+		// err is a part of the expected error, or empty if the config is valid.
+		err string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *Config) {},
+		},
+		{
+			name:   "empty listen address",
+			modify: func(c *Config) { c.ListenAddress = "" },
+			err:    "listen address is empty",
+		},
+		{
+			name:   "negative poll interval",
+			modify: func(c *Config) { c.PollInterval = -time.Second },
+			err:    "poll interval is negative",
+		},
+		{
+			name:   "max backoff below min backoff",
+			modify: func(c *Config) { c.ReconnectMaxBackoff = time.Millisecond },
+			err:    "reconnect max backoff is less than min backoff",
+		},
+		{
+			name:   "bins without group size",
+			modify: func(c *Config) { c.Collectors = map[string]bool{"dsl_bins": true}; c.DslBinsGroupSize = 0 },
+			err:    "bins group size must be positive",
+		},
+		{
+			name:   "no credentials",
+			modify: func(c *Config) { c.TargetPassword = "" },
+			err:    "no password or ssh key path provided",
+		},
+		{
+			name:   "constant label",
+			modify: func(c *Config) { c.Labels = map[string]string{"site": "home"} },
+		},
+		{
+			name:   "invalid constant label name",
+			modify: func(c *Config) { c.Labels = map[string]string{"1site": "home"} },
+			err:    `invalid label name "1site"`,
+		},
+		{
+			name:   "constant label used by the metrics",
+			modify: func(c *Config) { c.Labels = map[string]string{"direction": "down"} },
+			err:    `label "direction" is used by the metrics of the exporter`,
+		},
+		{
+			name: "target label used by the metrics",
+			modify: func(c *Config) {
+				c.Targets = []Target{{Name: "home", Host: "192.168.1.1", Labels: map[string]string{"collector": "x"}}}
+			},
+			err: `target "home": label "collector" is used by the metrics of the exporter`,
+		},
+		{
+			name: "targets without target client",
+			modify: func(c *Config) {
+				c.TargetClient = ""
+				c.Targets = []Target{{Host: "192.168.1.1", Module: Module{Client: "Lantiq (SSH)"}}}
+			},
+		},
+		{
+			name: "module without credentials",
+			modify: func(c *Config) {
+				c.TargetUser = ""
+				c.Modules = map[string]Module{"lantiq": {Client: "Lantiq (SSH)", Password: "secret"}}
+			},
+			err: `module "lantiq": target user is empty`,
+		},
+		{
+			name: "module with invalid target pattern",
+			modify: func(c *Config) {
+				c.Modules = map[string]Module{"lantiq": {Targets: Patterns{Include: []string{"192.168.1.(1"}}}}
+			},
+			err: `module "lantiq": targets: invalid pattern`,
+		},
+		{
+			name: "target label",
+			modify: func(c *Config) {
+				c.Targets = []Target{{Name: "home", Host: "192.168.1.1", Labels: map[string]string{"site": "home"}}}
+			},
+		},
+		{
+			name: "invalid target label name",
+			modify: func(c *Config) {
+				c.Targets = []Target{{Name: "home", Host: "192.168.1.1", Labels: map[string]string{"1site": "home"}}}
+			},
+			err: `target "home": invalid label name "1site"`,
+		},
+		{
+			name: "reserved target label",
+			modify: func(c *Config) {
+				c.Targets = []Target{{Name: "home", Host: "192.168.1.1", Labels: map[string]string{TargetLabel: "x"}}}
+			},
+			err: `target "home": label "target" is reserved`,
+		},
+		{
+			name: "duplicate target",
+			modify: func(c *Config) {
+				c.Targets = []Target{{Host: "192.168.1.1"}, {Host: "192.168.1.1"}}
+			},
+			err: `target "192.168.1.1": duplicate name`,
+		},
+		{
+			name:   "contract",
+			modify: func(c *Config) { c.TargetContract = Contract{Downstream: 250000000, MinimumDownstream: 175000000} },
+		},
+		{
+			name:   "negative contracted rate",
+			modify: func(c *Config) { c.TargetContract = Contract{Upstream: -1} },
+			err:    "contracted rate is negative",
+		},
+		{
+			name:   "minimum rate above contracted rate",
+			modify: func(c *Config) { c.TargetContract = Contract{Downstream: 100000000, MinimumDownstream: 175000000} },
+			err:    "minimum downstream rate exceeds contracted rate",
+		},
+		{
+			name: "invalid filter pattern",
+			modify: func(c *Config) {
+				c.Filter = Filter{Metrics: Patterns{Exclude: []string{"xdsl_(rtop"}}}
+			},
+			err: "metrics filter: invalid pattern",
+		},
+		{
+			name: "rule",
+			modify: func(c *Config) {
+				c.RawDataRules = []RegexRule{{Name: "fec", Regex: `FEC:\s+(?P<down>\d+)\s+(\d+)`, Value: "${down}", Labels: map[string]string{"up": "$2"}}}
+			},
+		},
+		{
+			name: "rule without regex",
+			modify: func(c *Config) {
+				c.RawDataRules = []RegexRule{{Name: "fec"}}
+			},
+			err: `raw data: rule "fec": regex is empty`,
+		},
+		{
+			name: "rule value refers to missing submatch",
+			modify: func(c *Config) {
+				c.RawDataRules = []RegexRule{{Name: "fec", Regex: `FEC:\s+\d+`}}
+			},
+			err: `raw data: rule "fec": value: refers to submatch $1, but the regex has 0`,
+		},
+		{
+			name: "rule label refers to missing named submatch",
+			modify: func(c *Config) {
+				c.RawDataRules = []RegexRule{{Name: "fec", Regex: `FEC:\s+(\d+)`, Labels: map[string]string{"path": "${path}"}}}
+			},
+			err: `raw data: rule "fec": label "path": refers to submatch "path", which the regex does not have`,
+		},
+		{
+			name: "rule value with escaped dollar",
+			modify: func(c *Config) {
+				c.RawDataRules = []RegexRule{{Name: "fec", Regex: `FEC:\s+(\d+)`, Labels: map[string]string{"unit": "$$2"}}}
+			},
+		},
+		{
+			name: "duplicate rule",
+			modify: func(c *Config) {
+				c.RawDataRules = []RegexRule{{Name: "fec", Regex: `(\d+)`}, {Name: "fec", Regex: `(\d+)`}}
+			},
+			err: `raw data: rule "fec": duplicate name`,
+		},
+		{
+			name: "command with negative timeout",
+			modify: func(c *Config) {
+				c.Commands = []Command{{Name: "arp", Command: "cat /proc/net/arp", Format: CommandFormatPrometheus, Timeout: -time.Second}}
+			},
+			err: `command "arp": timeout must not be negative`,
+		},
+		{
+			name: "prometheus command with rules",
+			modify: func(c *Config) {
+				c.Commands = []Command{{Name: "arp", Command: "cat /proc/net/arp", Format: CommandFormatPrometheus, Rules: []RegexRule{{Name: "arp", Regex: `(\d+)`}}}}
+			},
+			err: `command "arp": rules are not used by the prometheus format`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := validConfig()
+			tt.modify(&c)
+
+			err := c.Check()
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("Check() = %v, want no error", err)
+			case tt.err != "" && err == nil:
+				t.Fatalf("Check() = nil, want error containing %q", tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Fatalf("Check() = %v, want error containing %q", err, tt.err)
+			}
+		})
+	}
+}
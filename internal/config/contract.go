@@ -0,0 +1,30 @@
+package config
+
+import "fmt"
+
+// Contract is the bandwidth a line is contracted for, in bit/s. Rates that are
+// zero are not known.
+type Contract struct {
+	Downstream        int64 `mapstructure:"downstream"`
+	Upstream          int64 `mapstructure:"upstream"`
+	MinimumDownstream int64 `mapstructure:"minimum_downstream"`
+	MinimumUpstream   int64 `mapstructure:"minimum_upstream"`
+}
+
+func (c Contract) check() []error {
+	var errs []error
+
+	if c.Downstream < 0 || c.Upstream < 0 || c.MinimumDownstream < 0 || c.MinimumUpstream < 0 {
+		errs = append(errs, fmt.Errorf("contracted rate is negative"))
+	}
+
+	if c.Downstream > 0 && c.MinimumDownstream > c.Downstream {
+		errs = append(errs, fmt.Errorf("minimum downstream rate exceeds contracted rate"))
+	}
+
+	if c.Upstream > 0 && c.MinimumUpstream > c.Upstream {
+		errs = append(errs, fmt.Errorf("minimum upstream rate exceeds contracted rate"))
+	}
+
+	return errs
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Filter selects the samples that are exposed by their metric name and by
+// the values of their labels.
+type Filter struct {
+	Metrics Patterns            `mapstructure:"metrics"`
+	Labels  map[string]Patterns `mapstructure:"labels"`
+}
+
+// Patterns keep the strings that match any of Include, or all strings if it
+// is empty, unless they match any of Exclude. Patterns are regular
+// expressions anchored at both ends.
+type Patterns struct {
+	Include []string `mapstructure:"include"`
+	Exclude []string `mapstructure:"exclude"`
+}
+
+// Matcher holds the compiled Patterns.
+type Matcher struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// IsZero reports whether the filter keeps every sample.
+func (f Filter) IsZero() bool {
+	if !f.Metrics.IsZero() {
+		return false
+	}
+	for _, p := range f.Labels {
+		if !p.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+func (f Filter) check() []error {
+	var errs []error
+
+	if _, err := f.Metrics.Compile(); err != nil {
+		errs = append(errs, fmt.Errorf("metrics filter: %w", err))
+	}
+
+	for name, p := range f.Labels {
+		if _, err := p.Compile(); err != nil {
+			errs = append(errs, fmt.Errorf("label %q filter: %w", name, err))
+		}
+	}
+
+	return errs
+}
+
+// IsZero reports whether the patterns keep every string.
+func (p Patterns) IsZero() bool {
+	return len(p.Include) == 0 && len(p.Exclude) == 0
+}
+
+// Compile compiles the patterns into a Matcher.
+func (p Patterns) Compile() (Matcher, error) {
+	var (
+		m   Matcher
+		err error
+	)
+	if m.include, err = compilePatterns(p.Include); err != nil {
+		return Matcher{}, err
+	}
+	if m.exclude, err = compilePatterns(p.Exclude); err != nil {
+		return Matcher{}, err
+	}
+	return m, nil
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	regexps := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		regexps = append(regexps, re)
+	}
+	return regexps, nil
+}
+
+// Match reports whether the string is kept.
+func (m Matcher) Match(s string) bool {
+	for _, re := range m.exclude {
+		if re.MatchString(s) {
+			return false
+		}
+	}
+	if len(m.include) == 0 {
+		return true
+	}
+	for _, re := range m.include {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
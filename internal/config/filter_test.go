@@ -0,0 +1,40 @@
+package config
+
+import "testing"
+
+func TestMatcherMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns Patterns
+		s        string
+		want     bool
+	}{
+		{"no patterns", Patterns{}, "eth0", true},
+		{"included", Patterns{Include: []string{"eth.*", "ptm0"}}, "ptm0", true},
+		{"not included", Patterns{Include: []string{"eth.*"}}, "wlan0", false},
+		{"excluded", Patterns{Exclude: []string{"lo"}}, "lo", false},
+		{"not excluded", Patterns{Exclude: []string{"lo"}}, "eth0", true},
+		{"exclude takes precedence", Patterns{Include: []string{".*"}, Exclude: []string{"veth.*"}}, "veth1", false},
+		{"anchored at the start", Patterns{Include: []string{"eth"}}, "veth", false},
+		{"anchored at the end", Patterns{Include: []string{"eth"}}, "eth0", false},
+		{"alternation is anchored", Patterns{Exclude: []string{"lo|eth"}}, "eth0", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := tt.patterns.Compile()
+			if err != nil {
+				t.Fatalf("Compile() = %v", err)
+			}
+			if got := m.Match(tt.s); got != tt.want {
+				t.Errorf("Match(%q) = %t, want %t", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPatternsCompileInvalid(t *testing.T) {
+	if _, err := (Patterns{Include: []string{"("}}).Compile(); err == nil {
+		t.Error("Compile() = nil, want error")
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Module describes how to log in to a class of modems that are probed through
+// the probe endpoint. Empty fields fall back to the command line flags.
+// Targets restricts the hosts that may be probed with the module, as its
+// credentials are sent to the probed host; it keeps every host if it is empty.
+type Module struct {
+	Client         string            `mapstructure:"client"`
+	Port           int               `mapstructure:"port"`
+	User           string            `mapstructure:"user"`
+	Password       string            `mapstructure:"password"`
+	SSHKeyPath     string            `mapstructure:"ssh_key_path"`
+	SSHPassphrase  string            `mapstructure:"ssh_passphrase"`
+	KnownHostsPath string            `mapstructure:"known_hosts_path"`
+	Options        map[string]string `mapstructure:"options"`
+	Targets        Patterns          `mapstructure:"targets"`
+}
+
+// ForModule returns a copy of the config that targets the given host using
+// the settings of the module.
+func (c Config) ForModule(host string, m Module) Config {
+	c.TargetHost = host
+
+	if m.Client != "" {
+		c.TargetClient = m.Client
+	}
+	if m.Port != 0 {
+		c.TargetPort = m.Port
+	}
+	if m.User != "" {
+		c.TargetUser = m.User
+	}
+	if m.Password != "" {
+		c.TargetPassword = m.Password
+	}
+	if m.SSHKeyPath != "" {
+		c.TargetSSHKeyPath = m.SSHKeyPath
+	}
+	if m.SSHPassphrase != "" {
+		c.TargetSSHPassphrase = m.SSHPassphrase
+	}
+	if m.KnownHostsPath != "" {
+		c.KnownHostsPath = m.KnownHostsPath
+	}
+	if m.Options != nil {
+		c.TargetOptions = m.Options
+	}
+
+	return c
+}
+
+// ProbeConfig returns the config to probe the target with the named module.
+func (c Config) ProbeConfig(target, module string) (Config, error) {
+	m, ok := c.Modules[module]
+	if !ok {
+		return Config{}, fmt.Errorf("unknown module %q", module)
+	}
+
+	if target == "" {
+		return Config{}, fmt.Errorf("target is empty")
+	}
+
+	if _, err := url.Parse(target); err != nil {
+		return Config{}, fmt.Errorf("invalid target: %w", err)
+	}
+
+	targets, err := m.Targets.Compile()
+	if err != nil {
+		return Config{}, fmt.Errorf("module %q: targets: %w", module, err)
+	}
+	if !targets.Match(target) {
+		return Config{}, fmt.Errorf("target %q is not allowed by module %q", target, module)
+	}
+
+	return c.ForModule(target, m), nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProbeConfig(t *testing.T) {
+	c := validConfig()
+	c.Modules = map[string]Module{
+		"any":  {Client: "Lantiq (SSH)"},
+		"home": {Client: "Lantiq (SSH)", Targets: Patterns{Include: []string{`192\.168\.1\.\d+`}}},
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		module string
+		// err is a part of the expected error, or empty if the target may be
+		// probed.
+		err string
+	}{
+		{"any target", "203.0.113.1", "any", ""},
+		{"allowed target", "192.168.1.1", "home", ""},
+		{"target not allowed", "203.0.113.1", "home", `target "203.0.113.1" is not allowed by module "home"`},
+		{"unknown module", "192.168.1.1", "office", `unknown module "office"`},
+		{"empty target", "", "home", "target is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.ProbeConfig(tt.target, tt.module)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("ProbeConfig() = %v, want no error", err)
+			case tt.err != "" && err == nil:
+				t.Fatalf("ProbeConfig() = nil, want error containing %q", tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Fatalf("ProbeConfig() = %v, want error containing %q", err, tt.err)
+			}
+			if tt.err == "" && got.TargetHost != tt.target {
+				t.Errorf("TargetHost = %q, want %q", got.TargetHost, tt.target)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// Types of the metrics of regex rules.
+const (
+	RuleTypeGauge   = "gauge"
+	RuleTypeCounter = "counter"
+)
+
+// RegexRule turns every match of a regular expression into a sample of a
+// metric. The value and the label values are templates that refer to the
+// submatches of the match as in regexp.Expand, e.g. "$1" or "${name}".
+type RegexRule struct {
+	Name   string            `mapstructure:"name"`
+	Help   string            `mapstructure:"help"`
+	Type   string            `mapstructure:"type"`
+	Regex  string            `mapstructure:"regex"`
+	Value  string            `mapstructure:"value"`
+	Labels map[string]string `mapstructure:"labels"`
+}
+
+func (r RegexRule) check() []error {
+	var errs []error
+
+	if !model.IsValidMetricName(model.LabelValue(r.Name)) {
+		errs = append(errs, fmt.Errorf("invalid metric name %q", r.Name))
+	}
+
+	switch r.Type {
+	case "", RuleTypeGauge, RuleTypeCounter:
+	default:
+		errs = append(errs, fmt.Errorf("invalid metric type %q", r.Type))
+	}
+
+	if r.Regex == "" {
+		errs = append(errs, fmt.Errorf("regex is empty"))
+	} else if re, err := regexp.Compile(r.Regex); err != nil {
+		errs = append(errs, fmt.Errorf("invalid regex: %w", err))
+	} else {
+		value := r.Value
+		if value == "" {
+			value = "$1"
+		}
+		for _, err := range checkTemplate(re, value) {
+			errs = append(errs, fmt.Errorf("value: %w", err))
+		}
+		names := make([]string, 0, len(r.Labels))
+		for name := range r.Labels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, err := range checkTemplate(re, r.Labels[name]) {
+				errs = append(errs, fmt.Errorf("label %q: %w", name, err))
+			}
+		}
+	}
+
+	return append(errs, checkLabels(r.Labels)...)
+}
+
+// checkTemplate reports the references of the template to submatches that
+// the regex does not have, which regexp.Expand silently replaces with an empty
+// string.
+func checkTemplate(re *regexp.Regexp, template string) []error {
+	var errs []error
+	for _, ref := range templateRefs(template) {
+		if n, err := strconv.Atoi(ref); err == nil {
+			if n > re.NumSubexp() {
+				errs = append(errs, fmt.Errorf("refers to submatch $%d, but the regex has %d", n, re.NumSubexp()))
+			}
+			continue
+		}
+		if re.SubexpIndex(ref) < 0 {
+			errs = append(errs, fmt.Errorf("refers to submatch %q, which the regex does not have", ref))
+		}
+	}
+	return errs
+}
+
+// templateRefs returns the names of the submatches referenced by a template,
+// following the syntax of regexp.Expand.
+func templateRefs(template string) []string {
+	var refs []string
+	for {
+		i := strings.IndexByte(template, '$')
+		if i < 0 {
+			return refs
+		}
+		template = template[i+1:]
+
+		if strings.HasPrefix(template, "$") {
+			template = template[1:]
+			continue
+		}
+
+		braced := strings.HasPrefix(template, "{")
+		if braced {
+			template = template[1:]
+		}
+		n := 0
+		for n < len(template) && isWordByte(template[n]) {
+			n++
+		}
+		if n == 0 || (braced && (n == len(template) || template[n] != '}')) {
+			// Not a reference; Expand keeps the $ as is.
+			continue
+		}
+		refs = append(refs, template[:n])
+		template = template[n:]
+		if braced {
+			template = template[1:]
+		}
+	}
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func checkRules(rules []RegexRule) []error {
+	var errs []error
+
+	names := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i)
+		}
+		if names[name] {
+			errs = append(errs, fmt.Errorf("rule %q: duplicate name", name))
+		}
+		names[name] = true
+
+		for _, err := range rule.check() {
+			errs = append(errs, fmt.Errorf("rule %q: %w", name, err))
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,72 @@
+package config
+
+// TargetLabel is the label that tells the targets of the config file apart.
+const TargetLabel = "target"
+
+// Target is a modem listed in the config file. Empty fields fall back to the
+// command line flags.
+type Target struct {
+	Name     string `mapstructure:"name"`
+	Host     string `mapstructure:"host"`
+	Module   `mapstructure:",squash"`
+	Rtop     Rtop              `mapstructure:"rtop"`
+	Labels   map[string]string `mapstructure:"labels"`
+	Contract Contract          `mapstructure:"contract"`
+}
+
+// Rtop describes how the system stats of a target are collected. Empty fields
+// fall back to the settings of the target, except for the port, which falls
+// back to the rtop port of the command line flags.
+type Rtop struct {
+	Disabled   bool   `mapstructure:"disabled"`
+	Port       int    `mapstructure:"port"`
+	User       string `mapstructure:"user"`
+	SSHKeyPath string `mapstructure:"ssh_key_path"`
+}
+
+// ForTarget returns a copy of the config that targets the given modem. The
+// target is named after its host unless a name is given.
+func (c Config) ForTarget(t Target) Config {
+	c = c.ForModule(t.Host, t.Module)
+
+	c.TargetName = t.Name
+	if c.TargetName == "" {
+		c.TargetName = t.Host
+	}
+	c.TargetLabels = t.Labels
+	if t.Contract != (Contract{}) {
+		c.TargetContract = t.Contract
+	}
+	c.RtopDisabled = t.Rtop.Disabled
+	if t.Rtop.Port != 0 {
+		c.RtopPort = t.Rtop.Port
+	}
+	c.RtopUser = t.Rtop.User
+	c.RtopSSHKeyPath = t.Rtop.SSHKeyPath
+
+	return c
+}
+
+// TargetConfigs returns the config of every target of the config file. The
+// static labels of all targets are padded to the same set of label names, so
+// their metrics can be served from a single endpoint.
+func (c Config) TargetConfigs() []Config {
+	names := make(map[string]bool)
+	for _, t := range c.Targets {
+		for name := range t.Labels {
+			names[name] = true
+		}
+	}
+
+	configs := make([]Config, 0, len(c.Targets))
+	for _, t := range c.Targets {
+		tc := c.ForTarget(t)
+		tc.TargetLabels = make(map[string]string, len(names))
+		for name := range names {
+			tc.TargetLabels[name] = t.Labels[name]
+		}
+		configs = append(configs, tc)
+	}
+
+	return configs
+}
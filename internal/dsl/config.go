@@ -2,12 +2,17 @@ package dsl
 
 import (
 	"fmt"
+	"net"
+	"strconv"
 
 	"3e8.eu/go/dsl"
 
 	"github.com/Dentrax/xdsl-exporter/internal/config"
 )
 
+// GenerateConfigFrom returns the go-dsl config of the target. The port is only
+// passed to go-dsl if it is set, so every client keeps its default port
+// otherwise, e.g. 23 for Telnet.
 func GenerateConfigFrom(cfg config.Config) (*dsl.Config, error) {
 	client := dsl.ClientType(cfg.TargetClient)
 	if !client.IsValid() {
@@ -24,14 +29,19 @@ func GenerateConfigFrom(cfg config.Config) (*dsl.Config, error) {
 		return nil, err
 	}
 
+	host := cfg.TargetHost
+	if cfg.TargetPort != 0 {
+		host = net.JoinHostPort(host, strconv.Itoa(cfg.TargetPort))
+	}
+
 	return &dsl.Config{
 		Type:            client,
-		Host:            cfg.TargetHost,
+		Host:            host,
 		User:            cfg.TargetUser,
 		AuthPassword:    getAuthPassword(cfg.TargetPassword),
 		AuthPrivateKeys: getAuthPrivateKeys(sshKey, cfg.TargetSSHPassphrase),
 		KnownHosts:      knownHosts,
-		Options:         nil,
+		Options:         cfg.TargetOptions,
 	}, nil
 }
 
@@ -17,7 +17,18 @@ func GetSupportedClients() []string {
 	return result
 }
 
-func New(cfg config.Config) (dsl.Client, error) {
+// New returns a client for the target that connects lazily on its first
+// update, so the exporter can start while the modem is still unreachable.
+// Only the configuration is validated up front.
+func New(cfg config.Config) (*SupervisedClient, error) {
+	if _, err := GenerateConfigFrom(cfg); err != nil {
+		return nil, fmt.Errorf("generate dsl config: %w", err)
+	}
+
+	return newSupervisedClient(cfg), nil
+}
+
+func newClient(cfg config.Config) (dsl.Client, error) {
 	c, err := GenerateConfigFrom(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("generate dsl config: %w", err)
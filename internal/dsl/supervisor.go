@@ -0,0 +1,207 @@
+package dsl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"3e8.eu/go/dsl"
+	"3e8.eu/go/dsl/models"
+	"github.com/jpillora/backoff"
+
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+)
+
+// ConnectError is returned when the client could not (re)connect to the modem.
+type ConnectError struct {
+	Err error
+}
+
+func (e *ConnectError) Error() string {
+	return "connect: " + e.Err.Error()
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// errClosed is returned by the polls of a closed client.
+var errClosed = errors.New("client is closed")
+
+// SupervisedClient wraps a dsl.Client and rebuilds it from the stored config
+// whenever the modem drops the session. The first connection is made on the
+// first update. Reconnects are throttled with an exponential backoff with
+// jitter, so a rebooting modem is not hammered with login attempts on every
+// scrape.
+type SupervisedClient struct {
+	cfg config.Config
+
+	// mu guards the fields below but is not held while the modem is polled,
+	// so that Close does not wait for a poll that hangs.
+	mu        sync.Mutex
+	client    dsl.Client
+	closed    bool
+	backoff   *backoff.Backoff
+	retryAt   time.Time
+	attempts  uint64
+	successes uint64
+}
+
+func newSupervisedClient(cfg config.Config) *SupervisedClient {
+	return &SupervisedClient{
+		cfg: cfg,
+		backoff: &backoff.Backoff{
+			Min:    cfg.ReconnectMinBackoff,
+			Max:    cfg.ReconnectMaxBackoff,
+			Factor: 2,
+			Jitter: true,
+		},
+	}
+}
+
+// UpdateData polls the modem, connecting first if there is no session yet or
+// the previous one was torn down. go-dsl cannot cancel a poll, so the session
+// is torn down when ctx is done, which ends a poll that hangs. Any other error
+// tears the session down as well, unless it is known to come from parsing the
+// output of the modem; the session is then rebuilt on a later call.
+func (c *SupervisedClient) UpdateData(ctx context.Context) error {
+	client, err := c.connect()
+	if err != nil {
+		return err
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- client.UpdateData() }()
+
+	select {
+	case err := <-errc:
+		if err != nil {
+			if !isParseError(err) {
+				c.teardown(client)
+			}
+			return fmt.Errorf("update data: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		c.teardown(client)
+		return fmt.Errorf("update data: %w", ctx.Err())
+	}
+}
+
+// isParseError reports whether the error comes from parsing the output of the
+// modem, which leaves the session intact. go-dsl does not always wrap the
+// errors of the session, so errors are not matched against those.
+func isParseError(err error) bool {
+	var (
+		numErr    *strconv.NumError
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	return errors.As(err, &numErr) || errors.As(err, &syntaxErr) || errors.As(err, &typeErr)
+}
+
+func (c *SupervisedClient) Status() models.Status {
+	client := c.current()
+	if client == nil {
+		return models.Status{}
+	}
+	return client.Status()
+}
+
+func (c *SupervisedClient) Bins() models.Bins {
+	client := c.current()
+	if client == nil {
+		return models.Bins{}
+	}
+	return client.Bins()
+}
+
+func (c *SupervisedClient) RawData() []byte {
+	client := c.current()
+	if client == nil {
+		return nil
+	}
+	return client.RawData()
+}
+
+// Close closes the session. A poll in progress fails once its session is
+// closed, and later polls fail without connecting again.
+func (c *SupervisedClient) Close() {
+	c.mu.Lock()
+	client := c.client
+	c.client = nil
+	c.closed = true
+	c.mu.Unlock()
+
+	if client != nil {
+		client.Close()
+	}
+}
+
+func (c *SupervisedClient) current() dsl.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.client
+}
+
+// ReconnectStats returns the number of connection attempts and successful
+// connections since the client was created.
+func (c *SupervisedClient) ReconnectStats() (attempts, successes uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.attempts, c.successes
+}
+
+// connect returns the client, connecting first if there is none and the
+// client was not closed.
+func (c *SupervisedClient) connect() (dsl.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, errClosed
+	}
+
+	if c.client != nil {
+		return c.client, nil
+	}
+
+	if wait := time.Until(c.retryAt); wait > 0 {
+		return nil, &ConnectError{Err: fmt.Errorf("waiting %s before next attempt", wait.Round(time.Second))}
+	}
+
+	c.attempts++
+	client, err := newClient(c.cfg)
+	if err != nil {
+		c.retryAt = time.Now().Add(c.backoff.Duration())
+		return nil, &ConnectError{Err: err}
+	}
+
+	c.client = client
+	c.successes++
+	c.backoff.Reset()
+	c.retryAt = time.Time{}
+
+	return client, nil
+}
+
+// teardown closes the client and delays the next connection attempt, unless
+// the client was replaced or closed in the meantime.
+func (c *SupervisedClient) teardown(client dsl.Client) {
+	c.mu.Lock()
+	if c.client != client {
+		c.mu.Unlock()
+		return
+	}
+	c.client = nil
+	c.retryAt = time.Now().Add(c.backoff.Duration())
+	c.mu.Unlock()
+
+	client.Close()
+}
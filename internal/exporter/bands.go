@@ -0,0 +1,157 @@
+package exporter
+
+import (
+	"fmt"
+	"math"
+
+	"3e8.eu/go/dsl/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// snrGap is the SNR gap in dB of uncoded QAM at a bit error rate of 1e-7. A
+// tone carrying b bits needs an SNR of snrGap + 10*log10(2^b - 1) dB, and the
+// excess is its margin. Coding gain is not accounted for, so the estimated
+// margins are conservative.
+const snrGap = 9.75
+
+// bandStats aggregates the per-tone data of a single band.
+type bandStats struct {
+	snrMargin         float64
+	lineAttenuation   float64
+	signalAttenuation float64
+	bits              float64
+	usableTones       int
+}
+
+// bandMetric declares a metric aggregated per band.
+type bandMetric struct {
+	name  string
+	help  string
+	value func(bandStats) float64
+}
+
+var bandMetrics = []bandMetric{
+	{"band_snr_margin_estimated_decibels", "Estimated average SNR margin of the tones of the band carrying bits.", func(s bandStats) float64 { return s.snrMargin }},
+	{"band_line_attenuation_decibels", "Line attenuation (LATN) of the band.", func(s bandStats) float64 { return s.lineAttenuation }},
+	{"band_signal_attenuation_decibels", "Signal attenuation (SATN) of the band.", func(s bandStats) float64 { return s.signalAttenuation }},
+	{"band_bits", "Average number of bits loaded on the tones of the band.", func(s bandStats) float64 { return s.bits }},
+	{"band_usable_tones", "Number of tones of the band carrying bits.", func(s bandStats) float64 { return float64(s.usableTones) }},
+}
+
+// newBandDescs returns the descs of the per-band metrics, indexed like
+// bandMetrics.
+func newBandDescs(table *descTable, namespace string, constLabels prometheus.Labels) []*prometheus.Desc {
+	descs := make([]*prometheus.Desc, len(bandMetrics))
+	for i, m := range bandMetrics {
+		descs[i] = table.new(prometheus.BuildFQName(namespace, SubsystemDsl, m.name), m.help, []string{"direction", "band"}, constLabels)
+	}
+	return descs
+}
+
+func (e *Exporter) collectBands(bins models.Bins, mode models.ModeType, metrics chan<- prometheus.Metric) {
+	for _, d := range directions(bins) {
+		for i, band := range d.bands {
+			name := bandName(d.name, i, mode, bins.Bandplan)
+			stats := aggregateBand(d, band)
+
+			for i, m := range bandMetrics {
+				if value := m.value(stats); !math.IsNaN(value) {
+					e.sample(metrics, e.bandDescs[i], prometheus.GaugeValue, value, d.name, name)
+				}
+			}
+		}
+	}
+}
+
+// bandName names the i-th band of the direction the way modems do: downstream
+// bands are numbered from D1, upstream bands from U1. The upstream band of a
+// VDSL2 line that lies below the first downstream band is U0; the upstream
+// band of ADSL lies there as well, but is not called so.
+func bandName(direction string, i int, mode models.ModeType, bandplan models.BandsDownUp) string {
+	if direction == directionDownstream {
+		return fmt.Sprintf("D%d", i+1)
+	}
+
+	offset := 1
+	if mode == models.ModeTypeVDSL2 && len(bandplan.Upstream) > 0 && len(bandplan.Downstream) > 0 && bandplan.Upstream[0].Start < bandplan.Downstream[0].Start {
+		offset = 0
+	}
+	return fmt.Sprintf("U%d", i+offset)
+}
+
+// aggregateBand computes the statistics of a band from the per-tone data of
+// its direction. LATN averages the Hlog of all tones of the band and SATN only
+// that of the tones carrying bits. Statistics without any data are NaN and
+// are not exposed.
+func aggregateBand(d binsDirection, band models.Band) bandStats {
+	var (
+		margin, latn, satn, bits     float64
+		marginN, latnN, satnN, bitsN int
+		usable                       int
+	)
+
+	for tone := band.Start; tone <= band.End; tone++ {
+		b, hasBits := bitsAt(d.bits, tone)
+		hlog, hasHlog := valueAt(d.hlog, tone)
+		snr, hasSNR := valueAt(d.snr, tone)
+
+		if hasBits {
+			bits += float64(b)
+			bitsN++
+			if b > 0 {
+				usable++
+			}
+		}
+
+		if hasHlog {
+			latn -= hlog
+			latnN++
+			if b > 0 {
+				satn -= hlog
+				satnN++
+			}
+		}
+
+		if hasSNR && b > 0 {
+			margin += snr - snrGap - 10*math.Log10(math.Exp2(float64(b))-1)
+			marginN++
+		}
+	}
+
+	return bandStats{
+		snrMargin:         average(margin, marginN),
+		lineAttenuation:   average(latn, latnN),
+		signalAttenuation: average(satn, satnN),
+		bits:              average(bits, bitsN),
+		usableTones:       usable,
+	}
+}
+
+// valueAt returns the value of the tone, whose group is determined by the
+// group size reported by go-dsl.
+func valueAt(b models.BinsFloat, tone int) (float64, bool) {
+	size := b.GroupSize
+	if size <= 0 {
+		size = 1
+	}
+
+	i := tone / size
+	if i < 0 || i >= len(b.Data) || math.IsNaN(b.Data[i]) {
+		return 0, false
+	}
+	return b.Data[i], true
+}
+
+func bitsAt(b models.BinsBits, tone int) (int8, bool) {
+	if tone < 0 || tone >= len(b.Data) {
+		return 0, false
+	}
+	return b.Data[tone], true
+}
+
+func average(sum float64, n int) float64 {
+	if n == 0 {
+		return math.NaN()
+	}
+	return sum / float64(n)
+}
@@ -0,0 +1,122 @@
+package exporter
+
+import (
+	"math"
+	"testing"
+
+	"3e8.eu/go/dsl/models"
+)
+
+func TestBandName(t *testing.T) {
+	vdsl2 := models.BandsDownUp{
+		Downstream: []models.Band{{Start: 33, End: 859}, {Start: 1206, End: 1971}},
+		Upstream:   []models.Band{{Start: 6, End: 31}, {Start: 870, End: 1205}},
+	}
+	adsl := models.BandsDownUp{
+		Downstream: []models.Band{{Start: 33, End: 511}},
+		Upstream:   []models.Band{{Start: 6, End: 31}},
+	}
+	vdsl2NoU0 := models.BandsDownUp{
+		Downstream: []models.Band{{Start: 33, End: 859}},
+		Upstream:   []models.Band{{Start: 870, End: 1205}},
+	}
+
+	tests := []struct {
+		name      string
+		direction string
+		i         int
+		mode      models.ModeType
+		bandplan  models.BandsDownUp
+		want      string
+	}{
+		{"first downstream band", directionDownstream, 0, models.ModeTypeVDSL2, vdsl2, "D1"},
+		{"second downstream band", directionDownstream, 1, models.ModeTypeVDSL2, vdsl2, "D2"},
+		{"VDSL2 band below downstream", directionUpstream, 0, models.ModeTypeVDSL2, vdsl2, "U0"},
+		{"VDSL2 band after U0", directionUpstream, 1, models.ModeTypeVDSL2, vdsl2, "U1"},
+		{"VDSL2 without U0", directionUpstream, 0, models.ModeTypeVDSL2, vdsl2NoU0, "U1"},
+		{"ADSL upstream band", directionUpstream, 0, models.ModeTypeADSL2Plus, adsl, "U1"},
+		{"unknown bandplan", directionUpstream, 0, models.ModeTypeVDSL2, models.BandsDownUp{}, "U1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bandName(tt.direction, tt.i, tt.mode, tt.bandplan); got != tt.want {
+				t.Errorf("bandName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregateBand(t *testing.T) {
+	nan := math.NaN()
+
+	// margin returns the estimated margin of a tone carrying b bits.
+	margin := func(snr float64, b int) float64 {
+		return snr - snrGap - 10*math.Log10(math.Exp2(float64(b))-1)
+	}
+
+	d := binsDirection{
+		bits: models.BinsBits{Data: []int8{0, 2, 4, 0, 6, 6}},
+		snr:  models.BinsFloat{GroupSize: 1, Data: []float64{5, 20, 30, nan, 40, 44}},
+		hlog: models.BinsFloat{GroupSize: 2, Data: []float64{-10, -20, -30}},
+	}
+
+	tests := []struct {
+		name string
+		band models.Band
+		want bandStats
+	}{
+		{
+			name: "whole band",
+			band: models.Band{Start: 0, End: 5},
+			want: bandStats{
+				snrMargin:         (margin(20, 2) + margin(30, 4) + margin(40, 6) + margin(44, 6)) / 4,
+				lineAttenuation:   20,
+				signalAttenuation: (10 + 20 + 30 + 30) / 4.0,
+				bits:              3,
+				usableTones:       4,
+			},
+		},
+		{
+			name: "band without bits",
+			band: models.Band{Start: 3, End: 3},
+			want: bandStats{
+				snrMargin:         nan,
+				lineAttenuation:   20,
+				signalAttenuation: nan,
+				bits:              0,
+				usableTones:       0,
+			},
+		},
+		{
+			name: "band beyond the data",
+			band: models.Band{Start: 10, End: 12},
+			want: bandStats{
+				snrMargin:         nan,
+				lineAttenuation:   nan,
+				signalAttenuation: nan,
+				bits:              nan,
+				usableTones:       0,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := aggregateBand(d, tt.band)
+
+			check := func(name string, got, want float64) {
+				if math.IsNaN(want) != math.IsNaN(got) || (!math.IsNaN(want) && math.Abs(got-want) > 1e-9) {
+					t.Errorf("%s = %v, want %v", name, got, want)
+				}
+			}
+			check("snrMargin", got.snrMargin, tt.want.snrMargin)
+			check("lineAttenuation", got.lineAttenuation, tt.want.lineAttenuation)
+			check("signalAttenuation", got.signalAttenuation, tt.want.signalAttenuation)
+			check("bits", got.bits, tt.want.bits)
+			if got.usableTones != tt.want.usableTones {
+				t.Errorf("usableTones = %d, want %d", got.usableTones, tt.want.usableTones)
+			}
+		})
+	}
+}
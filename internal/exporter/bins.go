@@ -0,0 +1,158 @@
+package exporter
+
+import (
+	"math"
+	"strconv"
+
+	"3e8.eu/go/dsl/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	directionDownstream = "downstream"
+	directionUpstream   = "upstream"
+)
+
+// binsDirection holds the per-tone data of a single direction.
+type binsDirection struct {
+	name  string
+	bands []models.Band
+	bits  models.BinsBits
+	snr   models.BinsFloat
+	qln   models.BinsFloat
+	hlog  models.BinsFloat
+}
+
+// binMetric declares a per-tone metric, which is averaged over groups of
+// tones.
+type binMetric struct {
+	name string
+	help string
+	// values returns the per-tone data of the direction and the number of
+	// tones go-dsl reports per value.
+	values func(d binsDirection) ([]float64, int)
+}
+
+var binMetrics = []binMetric{
+	{"bin_snr_decibels", "Average signal-to-noise ratio of the tones of the group.", func(d binsDirection) ([]float64, int) { return d.snr.Data, d.snr.GroupSize }},
+	{"bin_qln_dbm_per_hertz", "Average quiet line noise of the tones of the group.", func(d binsDirection) ([]float64, int) { return d.qln.Data, d.qln.GroupSize }},
+	{"bin_hlog_decibels", "Average channel characteristics (Hlog) of the tones of the group.", func(d binsDirection) ([]float64, int) { return d.hlog.Data, d.hlog.GroupSize }},
+	{"bin_bits", "Average number of bits loaded on the tones of the group.", func(d binsDirection) ([]float64, int) { return bitsToFloat64(d.bits.Data), 1 }},
+}
+
+// binGroup is the average of the values of a group of tones, keyed by the
+// first tone of the group.
+type binGroup struct {
+	tone  int
+	value float64
+}
+
+func directions(bins models.Bins) []binsDirection {
+	return []binsDirection{
+		{
+			name:  directionDownstream,
+			bands: bins.Bandplan.Downstream,
+			bits:  bins.Bits.Downstream,
+			snr:   bins.SNR.Downstream,
+			qln:   bins.QLN.Downstream,
+			hlog:  bins.Hlog.Downstream,
+		},
+		{
+			name:  directionUpstream,
+			bands: bins.Bandplan.Upstream,
+			bits:  bins.Bits.Upstream,
+			snr:   bins.SNR.Upstream,
+			qln:   bins.QLN.Upstream,
+			hlog:  bins.Hlog.Upstream,
+		},
+	}
+}
+
+// newBinDescs returns the descs of the per-tone metrics, indexed like
+// binMetrics.
+func newBinDescs(table *descTable, namespace string, constLabels prometheus.Labels) []*prometheus.Desc {
+	descs := make([]*prometheus.Desc, len(binMetrics))
+	for i, m := range binMetrics {
+		descs[i] = table.new(prometheus.BuildFQName(namespace, SubsystemDsl, m.name), m.help, []string{"direction", "tone"}, constLabels)
+	}
+	return descs
+}
+
+func (e *Exporter) collectBins(bins models.Bins, metrics chan<- prometheus.Metric) {
+	for _, d := range directions(bins) {
+		for i, m := range binMetrics {
+			data, groupSize := m.values(d)
+			e.collectBinGroups(metrics, e.binDescs[i], d.name, groupBins(data, groupSize, e.binsGroupSize, d.bands))
+		}
+	}
+}
+
+func (e *Exporter) collectBinGroups(metrics chan<- prometheus.Metric, desc *prometheus.Desc, direction string, groups []binGroup) {
+	for _, g := range groups {
+		e.sample(metrics, desc, prometheus.GaugeValue, g.value, direction, strconv.Itoa(g.tone))
+	}
+}
+
+// groupBins averages per-tone values into groups of size tones. Each value
+// covers step tones, as reported by go-dsl, so groups are never smaller than
+// step. Values that are not a number and tones outside the given bands are
+// ignored; all tones are used if no bands are known.
+func groupBins(values []float64, step, size int, bands []models.Band) []binGroup {
+	if step <= 0 {
+		step = 1
+	}
+	if size < step {
+		size = step
+	}
+
+	var (
+		groups []binGroup
+		sum    float64
+		count  int
+		tone   = -1
+	)
+	flush := func() {
+		if count > 0 {
+			groups = append(groups, binGroup{tone: tone, value: sum / float64(count)})
+		}
+		sum, count = 0, 0
+	}
+
+	for i, value := range values {
+		t := i * step
+		if math.IsNaN(value) || !inBands(t, bands) {
+			continue
+		}
+
+		if start := t / size * size; start != tone {
+			flush()
+			tone = start
+		}
+		sum += value
+		count++
+	}
+	flush()
+
+	return groups
+}
+
+// inBands reports whether the tone lies within one of the bands.
+func inBands(tone int, bands []models.Band) bool {
+	if len(bands) == 0 {
+		return true
+	}
+	for _, band := range bands {
+		if tone >= band.Start && tone <= band.End {
+			return true
+		}
+	}
+	return false
+}
+
+func bitsToFloat64(bits []int8) []float64 {
+	values := make([]float64, len(bits))
+	for i, b := range bits {
+		values[i] = float64(b)
+	}
+	return values
+}
@@ -0,0 +1,89 @@
+package exporter
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"3e8.eu/go/dsl/models"
+)
+
+func TestGroupBins(t *testing.T) {
+	nan := math.NaN()
+
+	tests := []struct {
+		name   string
+		values []float64
+		step   int
+		size   int
+		bands  []models.Band
+		want   []binGroup
+	}{
+		{
+			name:   "no data",
+			values: nil,
+			step:   1,
+			size:   4,
+			want:   nil,
+		},
+		{
+			name:   "groups of tones",
+			values: []float64{1, 2, 3, 4, 5, 6},
+			step:   1,
+			size:   2,
+			want:   []binGroup{{0, 1.5}, {2, 3.5}, {4, 5.5}},
+		},
+		{
+			name:   "last group is partial",
+			values: []float64{1, 2, 3, 4, 5},
+			step:   1,
+			size:   4,
+			want:   []binGroup{{0, 2.5}, {4, 5}},
+		},
+		{
+			name:   "values covering several tones",
+			values: []float64{1, 3, 5, 7},
+			step:   2,
+			size:   4,
+			want:   []binGroup{{0, 2}, {4, 6}},
+		},
+		{
+			name:   "groups never smaller than the step",
+			values: []float64{1, 3, 5},
+			step:   8,
+			size:   4,
+			want:   []binGroup{{0, 1}, {8, 3}, {16, 5}},
+		},
+		{
+			name:   "zero step",
+			values: []float64{1, 3},
+			step:   0,
+			size:   1,
+			want:   []binGroup{{0, 1}, {1, 3}},
+		},
+		{
+			name:   "NaN values are ignored",
+			values: []float64{nan, 2, nan, nan, 4, 6},
+			step:   1,
+			size:   2,
+			want:   []binGroup{{0, 2}, {4, 5}},
+		},
+		{
+			name:   "tones outside the bands are ignored",
+			values: []float64{1, 2, 3, 4, 5, 6, 7, 8},
+			step:   1,
+			size:   4,
+			bands:  []models.Band{{Start: 1, End: 2}, {Start: 6, End: 7}},
+			want:   []binGroup{{0, 2.5}, {4, 7.5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := groupBins(tt.values, tt.step, tt.size, tt.bands)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groupBins() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package exporter
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/Dentrax/xdsl-exporter/internal/rtop"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// collector emits a group of metrics of a target from the data polled from
+// its source. Collectors register themselves with registerCollector and are
+// enabled and disabled independently.
+type collector interface {
+	Describe(descs chan<- *prometheus.Desc)
+	Collect(snap snapshot, metrics chan<- prometheus.Metric)
+}
+
+type collectorFactory struct {
+	source           string
+	enabledByDefault bool
+	new              func(e *Exporter) collector
+}
+
+var collectorFactories = make(map[string]collectorFactory)
+
+func registerCollector(name, source string, enabledByDefault bool, factory func(e *Exporter) collector) {
+	if _, ok := collectorFactories[name]; ok {
+		panic(fmt.Sprintf("collector %q registered twice", name))
+	}
+	collectorFactories[name] = collectorFactory{
+		source:           source,
+		enabledByDefault: enabledByDefault,
+		new:              factory,
+	}
+}
+
+// CollectorNames returns the names of all collectors in order.
+func CollectorNames() []string {
+	names := make([]string, 0, len(collectorFactories))
+	for name := range collectorFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CollectorEnabledByDefault reports whether the collector is enabled unless it
+// is disabled explicitly.
+func CollectorEnabledByDefault(name string) bool {
+	return collectorFactories[name].enabledByDefault
+}
+
+// namedCollector is a collector enabled for an exporter.
+type namedCollector struct {
+	name   string
+	source string
+	collector
+}
+
+// newCollectors returns the enabled collectors in order. Collectors that are
+// not listed in enabled keep their default.
+func newCollectors(e *Exporter, enabled map[string]bool) []namedCollector {
+	var collectors []namedCollector
+	for _, name := range CollectorNames() {
+		factory := collectorFactories[name]
+
+		on, ok := enabled[name]
+		if !ok {
+			on = factory.enabledByDefault
+		}
+		if !on {
+			continue
+		}
+
+		collectors = append(collectors, namedCollector{
+			name:      name,
+			source:    factory.source,
+			collector: factory.new(e),
+		})
+	}
+	return collectors
+}
+
+// collectParam is the query parameter that selects the collectors of a scrape.
+const collectParam = "collect[]"
+
+// parseCollectors returns the collectors selected by the query of a request,
+// or nil if it does not select any.
+func parseCollectors(query url.Values) ([]string, error) {
+	names := query[collectParam]
+	for _, name := range names {
+		if _, ok := collectorFactories[name]; !ok {
+			return nil, fmt.Errorf("unknown collector %q, valid collectors are %s", name, strings.Join(CollectorNames(), ", "))
+		}
+	}
+	return names, nil
+}
+
+// selectCollectors returns the enabled collectors among the given names, or
+// all enabled collectors if no names are given. Like node_exporter, it fails
+// if a name is not among the enabled collectors, i.e. the collector is
+// disabled or the filter drops all of its metrics.
+func (e *Exporter) selectCollectors(names []string) ([]namedCollector, error) {
+	if len(names) == 0 {
+		return e.collectors, nil
+	}
+
+	selected := make(map[string]bool, len(names))
+	for _, name := range names {
+		selected[name] = true
+	}
+
+	var collectors []namedCollector
+	for _, c := range e.collectors {
+		if selected[c.name] {
+			collectors = append(collectors, c)
+			delete(selected, c.name)
+		}
+	}
+
+	for _, name := range names {
+		if selected[name] {
+			return nil, fmt.Errorf("collector %q is disabled or all of its metrics are filtered out", name)
+		}
+	}
+	return collectors, nil
+}
+
+// pollPlan is the data that has to be polled from the modem for a set of
+// collectors.
+type pollPlan struct {
+	dsl       bool
+	dslBins   bool
+	rtopStats rtop.Stat
+	commands  bool
+}
+
+func planFor(collectors []namedCollector) pollPlan {
+	var plan pollPlan
+	for _, c := range collectors {
+		switch c.name {
+		case "dsl_bins", "dsl_bands":
+			plan.dslBins = true
+		}
+		switch c.source {
+		case SubsystemDsl:
+			plan.dsl = true
+		case SubsystemRtop:
+			plan.rtopStats |= rtopCollectors[c.name]
+		case SubsystemCommand:
+			plan.commands = true
+		}
+	}
+	return plan
+}
+
+func (p pollPlan) String() string {
+	return fmt.Sprintf("dsl=%t,bins=%t,rtop=%d,commands=%t", p.dsl, p.dslBins, p.rtopStats, p.commands)
+}
+
+func (e *Exporter) pollsDsl(plan pollPlan) bool {
+	return e.dsl != nil && plan.dsl
+}
+
+func (e *Exporter) pollsRtop(plan pollPlan) bool {
+	return e.rtop != nil && plan.rtopStats != 0
+}
+
+func (e *Exporter) pollsCommands(plan pollPlan) bool {
+	return e.rtop != nil && len(e.commands) > 0 && plan.commands
+}
+
+// polls reports whether the plan polls the source.
+func (e *Exporter) polls(plan pollPlan, source string) bool {
+	switch source {
+	case SubsystemDsl:
+		return e.pollsDsl(plan)
+	case SubsystemRtop:
+		return e.pollsRtop(plan)
+	case SubsystemCommand:
+		return e.pollsCommands(plan)
+	}
+	return false
+}
+
+// rtopCollectors maps the rtop collectors to the part of the system stats
+// they need, so that disabled collectors do not run commands on the modem.
+var rtopCollectors = map[string]rtop.Stat{
+	"rtop_host": rtop.StatHost,
+	"rtop_cpu":  rtop.StatCPU,
+	"rtop_mem":  rtop.StatMem,
+	"rtop_fs":   rtop.StatFS,
+	"rtop_net":  rtop.StatNet,
+}
+
+func init() {
+	registerCollector("dsl_status", SubsystemDsl, true, func(e *Exporter) collector { return dslStatusCollector{e} })
+	registerCollector("dsl_bins", SubsystemDsl, false, func(e *Exporter) collector { return binsCollector{e} })
+	registerCollector("dsl_bands", SubsystemDsl, false, func(e *Exporter) collector { return bandsCollector{e} })
+	registerCollector("dsl_raw", SubsystemDsl, true, func(e *Exporter) collector { return rawDataCollector{e} })
+	registerCollector("command", SubsystemCommand, true, func(e *Exporter) collector { return commandCollector{e} })
+
+	for name := range rtopCollectors {
+		name := name
+		registerCollector(name, SubsystemRtop, true, func(e *Exporter) collector { return rtopCollector{e, name} })
+	}
+}
+
+// dslStatusCollector emits the line status of go-dsl and what the exporter
+// derives from it across polls.
+type dslStatusCollector struct {
+	e *Exporter
+}
+
+func (c dslStatusCollector) Describe(descs chan<- *prometheus.Desc) {
+	e := c.e
+	for _, desc := range e.dslDescs {
+		descs <- desc
+	}
+	for _, desc := range e.legacyDescs {
+		if desc != nil {
+			descs <- desc
+		}
+	}
+	descs <- e.state
+	descs <- e.mode
+	descs <- e.modeInfo
+	descs <- e.uptime
+	descs <- e.lastSync
+	descs <- e.farEndInventory
+	descs <- e.nearEndInventory
+	descs <- e.downstreamVectoringState
+	descs <- e.upstreamVectoringState
+	for _, desc := range e.errorTotals {
+		descs <- desc
+	}
+	for _, desc := range e.contractDescs {
+		descs <- desc
+	}
+	for _, desc := range e.lineEventDescs {
+		descs <- desc
+	}
+}
+
+func (c dslStatusCollector) Collect(snap snapshot, metrics chan<- prometheus.Metric) {
+	c.e.collectDsl(snap.status, snap.dslUpdated, metrics)
+	c.e.collectErrorTotals(snap.errorTotals, metrics)
+	c.e.collectLineEvents(snap.lineEvents, metrics)
+	c.e.collectContract(snap.status, metrics)
+}
+
+// binsCollector emits the per-tone data of the line.
+type binsCollector struct {
+	e *Exporter
+}
+
+func (c binsCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range c.e.binDescs {
+		descs <- desc
+	}
+}
+
+func (c binsCollector) Collect(snap snapshot, metrics chan<- prometheus.Metric) {
+	c.e.collectBins(snap.bins, metrics)
+}
+
+// bandsCollector emits the per-band aggregates of the per-tone data.
+type bandsCollector struct {
+	e *Exporter
+}
+
+func (c bandsCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range c.e.bandDescs {
+		descs <- desc
+	}
+}
+
+func (c bandsCollector) Collect(snap snapshot, metrics chan<- prometheus.Metric) {
+	c.e.collectBands(snap.bins, snap.status.Mode.Type, metrics)
+}
+
+// rawDataCollector emits the metrics extracted from the raw data of go-dsl by
+// the rules of the config.
+type rawDataCollector struct {
+	e *Exporter
+}
+
+func (c rawDataCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, r := range c.e.rawDataRules {
+		descs <- r.desc
+	}
+}
+
+func (c rawDataCollector) Collect(snap snapshot, metrics chan<- prometheus.Metric) {
+	c.e.collectRegexRules(c.e.rawDataRules, snap.rawData, metrics)
+}
+
+// commandCollector emits the metrics of the commands of the config.
+type commandCollector struct {
+	e *Exporter
+}
+
+func (c commandCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, command := range c.e.commands {
+		for _, r := range command.rules {
+			descs <- r.desc
+		}
+	}
+}
+
+func (c commandCollector) Collect(snap snapshot, metrics chan<- prometheus.Metric) {
+	c.e.collectCommands(snap.commandOutputs, metrics)
+}
+
+// rtopCollector emits the system stats of a part of the host.
+type rtopCollector struct {
+	e    *Exporter
+	name string
+}
+
+func (c rtopCollector) Describe(descs chan<- *prometheus.Desc) {
+	for i, m := range rtopMetrics {
+		if m.collector == c.name {
+			descs <- c.e.rtopDescs[i]
+		}
+	}
+}
+
+func (c rtopCollector) Collect(snap snapshot, metrics chan<- prometheus.Metric) {
+	c.e.collectRtop(c.name, snap.stats, metrics)
+}
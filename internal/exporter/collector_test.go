@@ -0,0 +1,50 @@
+package exporter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+)
+
+func TestSelectCollectors(t *testing.T) {
+	e := newTestExporter(config.Config{
+		Filter: config.Filter{Metrics: config.Patterns{Exclude: []string{"xdsl_rtop_fs_.*"}}},
+	})
+
+	tests := []struct {
+		name  string
+		names []string
+		want  []string
+		// err is a part of the expected error, or empty if the names are
+		// valid.
+		err string
+	}{
+		{"all enabled collectors", nil, []string{"command", "dsl_raw", "dsl_status", "rtop_cpu", "rtop_host", "rtop_mem", "rtop_net"}, ""},
+		{"selected collectors", []string{"rtop_net", "dsl_status"}, []string{"dsl_status", "rtop_net"}, ""},
+		{"disabled collector", []string{"dsl_status", "dsl_bins"}, nil, `collector "dsl_bins" is disabled`},
+		{"filtered collector", []string{"rtop_fs"}, nil, `collector "rtop_fs" is disabled or all of its metrics are filtered out`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collectors, err := e.selectCollectors(tt.names)
+			switch {
+			case tt.err == "" && err != nil:
+				t.Fatalf("selectCollectors() = %v, want no error", err)
+			case tt.err != "" && err == nil:
+				t.Fatalf("selectCollectors() = nil, want error containing %q", tt.err)
+			case tt.err != "" && !strings.Contains(err.Error(), tt.err):
+				t.Fatalf("selectCollectors() = %v, want error containing %q", err, tt.err)
+			}
+
+			var got []string
+			for _, c := range collectors {
+				got = append(got, c.name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("selectCollectors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package exporter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// command is a compiled config.Command.
+type command struct {
+	name    string
+	command string
+	format  string
+	timeout time.Duration
+	rules   []regexRule
+}
+
+// defaultCommandTimeout bounds the commands if neither they nor rtop have a
+// timeout, as a command that hangs would keep its SSH session open forever.
+const defaultCommandTimeout = 10 * time.Second
+
+func newCommands(table *descTable, commands []config.Command, rtopTimeout time.Duration, namespace string, constLabels prometheus.Labels) []command {
+	compiled := make([]command, 0, len(commands))
+	for _, c := range commands {
+		timeout := c.Timeout
+		if timeout <= 0 {
+			timeout = rtopTimeout
+		}
+		if timeout <= 0 {
+			timeout = defaultCommandTimeout
+		}
+
+		compiled = append(compiled, command{
+			name:    c.Name,
+			command: c.Command,
+			format:  c.Format,
+			timeout: timeout,
+			rules: newRegexRules(table, c.Rules, func(name string) string {
+				return prometheus.BuildFQName(namespace, SubsystemCommand, name)
+			}, "Value extracted from the output of the command "+c.Name+".", constLabels),
+		})
+	}
+	return compiled
+}
+
+// commandsTimeout returns the time it takes to run all commands if each of
+// them runs into its timeout.
+func commandsTimeout(commands []command) time.Duration {
+	var timeout time.Duration
+	for _, c := range commands {
+		timeout += c.timeout
+	}
+	return timeout
+}
+
+// descCache keeps the Descs of the metrics that are only known once the
+// output of a command is parsed, so that each of them is built once.
+type descCache struct {
+	table       *descTable
+	namespace   string
+	constLabels prometheus.Labels
+
+	mu    sync.Mutex
+	descs map[string]*prometheus.Desc
+}
+
+func newDescCache(table *descTable, namespace string, constLabels prometheus.Labels) *descCache {
+	return &descCache{
+		table:       table,
+		namespace:   namespace,
+		constLabels: constLabels,
+		descs:       make(map[string]*prometheus.Desc),
+	}
+}
+
+func (c *descCache) get(fqName, help string, labels []string) *prometheus.Desc {
+	key := strings.Join(append([]string{fqName, help}, labels...), "\xff")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	desc, ok := c.descs[key]
+	if !ok {
+		desc = c.table.new(fqName, help, labels, c.constLabels)
+		c.descs[key] = desc
+	}
+	return desc
+}
+
+// getDataFromCommands runs the commands of the config one after another, each
+// within its own timeout. A failed command does not stop the others; its
+// series are dropped until it succeeds again and the first error is returned.
+func (e *Exporter) getDataFromCommands() error {
+	var firstErr error
+
+	outputs := make(map[string][]byte, len(e.commands))
+	for _, c := range e.commands {
+		output, err := e.rtop.Run(c.command, c.timeout)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("command %q: %w", c.name, err)
+			}
+			continue
+		}
+		outputs[c.name] = output
+	}
+
+	e.mu.Lock()
+	e.snapshot.commandOutputs = outputs
+	if len(outputs) > 0 {
+		e.snapshot.commandUpdated = time.Now()
+	}
+	e.mu.Unlock()
+
+	return firstErr
+}
+
+func (e *Exporter) collectCommands(outputs map[string][]byte, metrics chan<- prometheus.Metric) {
+	// A metric must not be exposed by more than one command.
+	seen := make(map[string]bool)
+	for _, c := range e.commands {
+		for _, r := range c.rules {
+			seen[e.descs.info(r.desc).name] = true
+		}
+	}
+
+	for _, c := range e.commands {
+		output, ok := outputs[c.name]
+		if !ok {
+			continue
+		}
+
+		switch c.format {
+		case config.CommandFormatPrometheus:
+			e.collectPrometheusOutput(c, output, seen, metrics)
+		default:
+			e.collectRegexRules(c.rules, output, metrics)
+		}
+	}
+}
+
+// collectPrometheusOutput emits the counters, gauges and untyped metrics of
+// output in the Prometheus text format under the command subsystem.
+func (e *Exporter) collectPrometheusOutput(c command, output []byte, seen map[string]bool, metrics chan<- prometheus.Metric) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(output))
+	if err != nil {
+		level.Warn(e.logger).Log("msg", "could not parse the output of the command", "command", c.name, "err", err.Error()) //nolint:errcheck
+		return
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		family := families[name]
+		fqName := prometheus.BuildFQName(e.commandDescs.namespace, SubsystemCommand, name)
+		if seen[fqName] {
+			level.Debug(e.logger).Log("msg", "skipping metric exposed by another command", "command", c.name, "metric", fqName) //nolint:errcheck
+			continue
+		}
+		seen[fqName] = true
+
+		help := family.GetHelp()
+		if help == "" {
+			help = "Value reported by the command " + c.name + "."
+		}
+
+		for _, m := range family.GetMetric() {
+			valueType, value, ok := metricValue(family.GetType(), m)
+			if !ok {
+				continue
+			}
+
+			labels := make([]string, 0, len(m.GetLabel()))
+			labelValues := make([]string, 0, len(m.GetLabel()))
+			for _, pair := range m.GetLabel() {
+				labels = append(labels, pair.GetName())
+				labelValues = append(labelValues, pair.GetValue())
+			}
+
+			e.sample(metrics, e.commandDescs.get(fqName, help, labels), valueType, value, labelValues...)
+		}
+	}
+}
+
+// metricValue returns the value of a counter, gauge or untyped metric.
+// Summaries and histograms are not supported.
+func metricValue(t dto.MetricType, m *dto.Metric) (prometheus.ValueType, float64, bool) {
+	switch t {
+	case dto.MetricType_COUNTER:
+		return prometheus.CounterValue, m.GetCounter().GetValue(), true
+	case dto.MetricType_GAUGE:
+		return prometheus.GaugeValue, m.GetGauge().GetValue(), true
+	case dto.MetricType_UNTYPED:
+		return prometheus.UntypedValue, m.GetUntyped().GetValue(), true
+	default:
+		return 0, 0, false
+	}
+}
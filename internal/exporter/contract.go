@@ -0,0 +1,73 @@
+package exporter
+
+import (
+	"3e8.eu/go/dsl/models"
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// contractRates are the contracted and minimum rates of one direction, in
+// bit/s, together with the rates of the line. Zero contracted rates are not
+// known.
+type contractRates struct {
+	direction  string
+	rate       float64
+	minimum    float64
+	actual     models.ValueBandwidth
+	attainable models.ValueBandwidth
+}
+
+// contractMetric declares a metric of the contract of the line, or of the
+// line compared to it.
+type contractMetric struct {
+	name  string
+	help  string
+	value func(contractRates) (float64, bool)
+}
+
+var contractMetrics = []contractMetric{
+	{"contract_rate_bits_per_second", "Contracted rate of the line.", func(c contractRates) (float64, bool) { return c.rate, c.rate > 0 }},
+	{"contract_minimum_rate_bits_per_second", "Minimum guaranteed rate of the line.", func(c contractRates) (float64, bool) { return c.minimum, c.minimum > 0 }},
+	{"actual_rate_contract_ratio", "Ratio of the actual rate to the contracted rate of the line.", func(c contractRates) (float64, bool) {
+		return bandwidthToBase(c.actual) / c.rate, c.rate > 0 && c.actual.Valid
+	}},
+	{"attainable_rate_contract_ratio", "Ratio of the attainable rate to the contracted rate of the line.", func(c contractRates) (float64, bool) {
+		return bandwidthToBase(c.attainable) / c.rate, c.rate > 0 && c.attainable.Valid
+	}},
+	{"below_contract_minimum", "Whether the actual rate of the line is below the minimum guaranteed rate.", func(c contractRates) (float64, bool) {
+		return boolToFloat64(bandwidthToBase(c.actual) < c.minimum), c.minimum > 0 && c.actual.Valid
+	}},
+}
+
+func directionContracts(c config.Contract, status models.Status) []contractRates {
+	return []contractRates{
+		{directionDownstream, float64(c.Downstream), float64(c.MinimumDownstream), status.DownstreamActualRate, status.DownstreamAttainableRate},
+		{directionUpstream, float64(c.Upstream), float64(c.MinimumUpstream), status.UpstreamActualRate, status.UpstreamAttainableRate},
+	}
+}
+
+// newContractDescs returns the descs of the contract metrics, indexed like
+// contractMetrics.
+func newContractDescs(table *descTable, namespace string, constLabels prometheus.Labels) []*prometheus.Desc {
+	descs := make([]*prometheus.Desc, len(contractMetrics))
+	for i, m := range contractMetrics {
+		descs[i] = table.new(prometheus.BuildFQName(namespace, SubsystemDsl, m.name), m.help, []string{"direction"}, constLabels)
+	}
+	return descs
+}
+
+// collectContract emits the contract and compares the rates of the line to
+// it.
+func (e *Exporter) collectContract(status models.Status, metrics chan<- prometheus.Metric) {
+	for _, c := range directionContracts(e.contract, status) {
+		for i, m := range contractMetrics {
+			if value, ok := m.value(c); ok {
+				e.sample(metrics, e.contractDescs[i], prometheus.GaugeValue, value, c.direction)
+			}
+		}
+	}
+}
+
+func bandwidthToBase(v models.ValueBandwidth) float64 {
+	return toBaseUnit(float64(v.Int), v.Unit())
+}
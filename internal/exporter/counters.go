@@ -0,0 +1,166 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"3e8.eu/go/dsl/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// errorCounter is an error counter of the modem. The modem resets its counters
+// when the line resyncs or the modem reboots, so they are accumulated into
+// monotonic totals by the exporter.
+type errorCounter struct {
+	name       string
+	help       string
+	downstream func(models.Status) models.IntValue
+	upstream   func(models.Status) models.IntValue
+}
+
+var errorCounters = []errorCounter{
+	{
+		name:       "rtx_tx_total",
+		help:       "Total number of retransmitted DTUs.",
+		downstream: func(s models.Status) models.IntValue { return s.DownstreamRTXTXCount },
+		upstream:   func(s models.Status) models.IntValue { return s.UpstreamRTXTXCount },
+	},
+	{
+		name:       "rtx_corrected_total",
+		help:       "Total number of DTUs corrected by retransmission.",
+		downstream: func(s models.Status) models.IntValue { return s.DownstreamRTXCCount },
+		upstream:   func(s models.Status) models.IntValue { return s.UpstreamRTXCCount },
+	},
+	{
+		name:       "rtx_uncorrected_total",
+		help:       "Total number of DTUs that could not be corrected by retransmission.",
+		downstream: func(s models.Status) models.IntValue { return s.DownstreamRTXUCCount },
+		upstream:   func(s models.Status) models.IntValue { return s.UpstreamRTXUCCount },
+	},
+	{
+		name:       "fec_errors_total",
+		help:       "Total number of errors corrected by forward error correction.",
+		downstream: func(s models.Status) models.IntValue { return s.DownstreamFECCount },
+		upstream:   func(s models.Status) models.IntValue { return s.UpstreamFECCount },
+	},
+	{
+		name:       "crc_errors_total",
+		help:       "Total number of CRC errors.",
+		downstream: func(s models.Status) models.IntValue { return s.DownstreamCRCCount },
+		upstream:   func(s models.Status) models.IntValue { return s.UpstreamCRCCount },
+	},
+	{
+		name:       "errored_seconds_total",
+		help:       "Total number of errored seconds.",
+		downstream: func(s models.Status) models.IntValue { return s.DownstreamESCount },
+		upstream:   func(s models.Status) models.IntValue { return s.UpstreamESCount },
+	},
+	{
+		name:       "severely_errored_seconds_total",
+		help:       "Total number of severely errored seconds.",
+		downstream: func(s models.Status) models.IntValue { return s.DownstreamSESCount },
+		upstream:   func(s models.Status) models.IntValue { return s.UpstreamSESCount },
+	},
+}
+
+type counterKey struct {
+	name      string
+	direction string
+}
+
+// accumulator keeps monotonic totals of counters that are reset by the modem.
+type accumulator struct {
+	mu     sync.Mutex
+	last   map[counterKey]int64
+	totals map[counterKey]float64
+	// uptime is the uptime of the line at the previous poll.
+	uptime time.Duration
+}
+
+func newAccumulator() *accumulator {
+	return &accumulator{
+		last:   make(map[counterKey]int64),
+		totals: make(map[counterKey]float64),
+	}
+}
+
+// observe records the error counters of the status and returns a copy of the
+// totals. A counter that is lower than at the previous poll has been reset and
+// counted up from zero since, so its whole value is added to the total. The
+// counters are also reset when the line resyncs, which shows in an uptime
+// lower than at the previous poll or in the line leaving showtime, so a counter
+// that climbed past its old value since is not missed. The counters are not
+// accumulated while the line is known to be out of showtime.
+func (a *accumulator) observe(status models.Status) map[counterKey]float64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	uptime := status.Uptime.Duration
+	outOfShowtime := status.State != models.StateUnknown && status.State != models.StateShowtime
+
+	if outOfShowtime || (uptime > 0 && uptime < a.uptime) {
+		a.reset()
+	}
+	a.uptime = uptime
+
+	if !outOfShowtime {
+		for _, c := range errorCounters {
+			a.add(counterKey{c.name, directionDownstream}, c.downstream(status))
+			a.add(counterKey{c.name, directionUpstream}, c.upstream(status))
+		}
+	}
+
+	totals := make(map[counterKey]float64, len(a.totals))
+	for key, total := range a.totals {
+		totals[key] = total
+	}
+	return totals
+}
+
+// reset records that the counters of the modem start from zero again, so their
+// next values are added to the totals as a whole.
+func (a *accumulator) reset() {
+	for key := range a.last {
+		a.last[key] = 0
+	}
+}
+
+func (a *accumulator) add(key counterKey, value models.IntValue) {
+	if !value.Valid {
+		return
+	}
+
+	last, seen := a.last[key]
+	switch {
+	case !seen:
+		a.totals[key] = float64(value.Int)
+	case value.Int >= last:
+		a.totals[key] += float64(value.Int - last)
+	default:
+		a.totals[key] += float64(value.Int)
+	}
+	a.last[key] = value.Int
+}
+
+func newErrorCounterDescs(table *descTable, namespace string, constLabels prometheus.Labels) map[string]*prometheus.Desc {
+	descs := make(map[string]*prometheus.Desc, len(errorCounters))
+	for _, c := range errorCounters {
+		descs[c.name] = table.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, c.name),
+			c.help+" Accumulated by the exporter across resyncs of the line.",
+			[]string{"direction"},
+			constLabels,
+		)
+	}
+	return descs
+}
+
+func (e *Exporter) collectErrorTotals(totals map[counterKey]float64, metrics chan<- prometheus.Metric) {
+	for _, c := range errorCounters {
+		for _, direction := range []string{directionDownstream, directionUpstream} {
+			if total, ok := totals[counterKey{c.name, direction}]; ok {
+				e.sample(metrics, e.errorTotals[c.name], prometheus.CounterValue, total, direction)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"3e8.eu/go/dsl/models"
+)
+
+func TestAccumulatorAdd(t *testing.T) {
+	valid := func(v int64) models.IntValue { return models.IntValue{Int: v, Valid: true} }
+	invalid := models.IntValue{}
+
+	tests := []struct {
+		name   string
+		values []models.IntValue
+		want   float64
+		// wantNone is set if no total is expected at all.
+		wantNone bool
+	}{
+		{name: "first value", values: []models.IntValue{valid(10)}, want: 10},
+		{name: "increasing", values: []models.IntValue{valid(10), valid(15), valid(30)}, want: 30},
+		{name: "unchanged", values: []models.IntValue{valid(10), valid(10)}, want: 10},
+		{name: "reset", values: []models.IntValue{valid(100), valid(5)}, want: 105},
+		{name: "reset to zero", values: []models.IntValue{valid(100), valid(0), valid(7)}, want: 107},
+		{name: "reset twice", values: []models.IntValue{valid(10), valid(20), valid(3), valid(8), valid(1)}, want: 29},
+		{name: "invalid values are skipped", values: []models.IntValue{valid(10), invalid, valid(12)}, want: 12},
+		{name: "only invalid values", values: []models.IntValue{invalid, invalid}, wantNone: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAccumulator()
+			key := counterKey{"crc_errors_total", directionDownstream}
+			for _, v := range tt.values {
+				a.add(key, v)
+			}
+
+			got, ok := a.totals[key]
+			if tt.wantNone {
+				if ok {
+					t.Fatalf("total = %v, want none", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("total = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccumulatorObserve(t *testing.T) {
+	// status returns a status whose downstream CRC counter has the value.
+	status := func(state models.State, uptime time.Duration, crc int64) models.Status {
+		return models.Status{
+			State:              state,
+			Uptime:             models.Duration{Duration: uptime},
+			DownstreamCRCCount: models.IntValue{Int: crc, Valid: true},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		statuses []models.Status
+		want     float64
+	}{
+		{
+			name: "same sync",
+			statuses: []models.Status{
+				status(models.StateShowtime, time.Hour, 10),
+				status(models.StateShowtime, 2*time.Hour, 25),
+			},
+			want: 25,
+		},
+		{
+			name: "uptime went backwards",
+			statuses: []models.Status{
+				status(models.StateShowtime, time.Hour, 10),
+				status(models.StateShowtime, time.Minute, 40),
+			},
+			want: 50,
+		},
+		{
+			name: "left showtime",
+			statuses: []models.Status{
+				status(models.StateShowtime, time.Hour, 10),
+				status(models.StateInitTraining, 0, 10),
+				status(models.StateShowtime, 3*time.Hour, 40),
+			},
+			want: 50,
+		},
+		{
+			name: "unknown state",
+			statuses: []models.Status{
+				status(models.StateUnknown, 0, 10),
+				status(models.StateUnknown, 0, 25),
+			},
+			want: 25,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newAccumulator()
+			var totals map[counterKey]float64
+			for _, s := range tt.statuses {
+				totals = a.observe(s)
+			}
+
+			key := counterKey{"crc_errors_total", directionDownstream}
+			if got := totals[key]; got != tt.want {
+				t.Errorf("total = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
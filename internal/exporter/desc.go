@@ -0,0 +1,44 @@
+package exporter
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// descTable keeps the name and the variable labels of every Desc built by an
+// exporter, as a Desc does not expose them.
+type descTable struct {
+	mu    sync.RWMutex
+	infos map[*prometheus.Desc]descInfo
+}
+
+// descInfo is what the exporter needs to know about a Desc to filter and
+// report its samples.
+type descInfo struct {
+	name   string
+	labels []string
+}
+
+func newDescTable() *descTable {
+	return &descTable{infos: make(map[*prometheus.Desc]descInfo)}
+}
+
+// new returns a Desc like prometheus.NewDesc and records its name and
+// variable labels.
+func (t *descTable) new(fqName, help string, labels []string, constLabels prometheus.Labels) *prometheus.Desc {
+	desc := prometheus.NewDesc(fqName, help, labels, constLabels)
+
+	t.mu.Lock()
+	t.infos[desc] = descInfo{name: fqName, labels: labels}
+	t.mu.Unlock()
+
+	return desc
+}
+
+func (t *descTable) info(desc *prometheus.Desc) descInfo {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.infos[desc]
+}
@@ -1,735 +1,603 @@
 package exporter
 
 import (
-	"3e8.eu/go/dsl"
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"3e8.eu/go/dsl/models"
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+	"github.com/Dentrax/xdsl-exporter/internal/dsl"
+	"github.com/Dentrax/xdsl-exporter/internal/rtop"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
-	rtop "github.com/rapidloop/rtop/pkg/client"
-	"github.com/rapidloop/rtop/pkg/types"
-	"strconv"
+	"golang.org/x/sync/singleflight"
 )
 
 const (
+	// Namespace is the default namespace of all metrics.
 	Namespace     = "xdsl"
 	SubsystemDsl  = "dsl"
 	SubsystemRtop = "rtop"
+	// SubsystemCommand holds the metrics of the commands of the config.
+	SubsystemCommand = "command"
+
+	SubsystemScrape = "scrape"
 )
 
+// dslSource is the client of the DSL status, implemented by
+// dsl.SupervisedClient.
+type dslSource interface {
+	UpdateData(ctx context.Context) error
+	Status() models.Status
+	Bins() models.Bins
+	RawData() []byte
+	ReconnectStats() (attempts, successes uint64)
+	Close()
+}
+
 type Exporter struct {
-	dsl    dsl.Client
+	dsl    dslSource
 	rtop   *rtop.Client
 	logger log.Logger
 
+	pollInterval time.Duration
+	maxStaleness time.Duration
+	dslTimeout   time.Duration
+	rtopTimeout  time.Duration
+
+	// collectors are the enabled collectors in order, and plan is the data
+	// polled for them.
+	collectors []namedCollector
+	plan       pollPlan
+	// filter drops the samples excluded by the config.
+	filter *filter
+	// descs holds the name and variable labels of every Desc.
+	descs *descTable
+
+	// binsGroupSize is the number of tones averaged into each series of the
+	// per-tone metrics.
+	binsGroupSize int
+	// contract is the bandwidth the line is contracted for.
+	contract config.Contract
+
+	// dslBusy, rtopBusy and commandBusy are held while a source is being
+	// polled, so a call that outlived its deadline finishes before the next
+	// one starts.
+	dslBusy     chan struct{}
+	rtopBusy    chan struct{}
+	commandBusy chan struct{}
+
+	// flight coalesces the polls of concurrent scrapes.
+	flight         singleflight.Group
+	coalesceWindow time.Duration
+	// lastRefresh is the time of the last poll of each plan.
+	lastRefresh map[pollPlan]time.Time
+	// polling holds the start of the polls of the sources in progress.
+	polling map[string]time.Time
+
+	mu       sync.RWMutex
+	snapshot snapshot
+
+	// accumulator turns the error counters of the modem into monotonic
+	// totals.
+	accumulator *accumulator
+	// lineTracker detects resyncs and trainings of the line.
+	lineTracker lineTracker
+
 	// via go-dsl
 	// see: https://github.com/janh/go-dsl/blob/690a62b79cd43d01b5f10fe2ef0d1a8a2b3f00f7/models/status.go#L13-L77
-	state                                *prometheus.Desc
-	mode                                 *prometheus.Desc
-	uptime                               *prometheus.Desc
-	farEndInventory                      *prometheus.Desc
-	nearEndInventory                     *prometheus.Desc
-	downstreamActualRate                 *prometheus.Desc
-	upstreamActualRate                   *prometheus.Desc
-	downstreamAttainableRate             *prometheus.Desc
-	upstreamAttainableRate               *prometheus.Desc
-	downstreamMinimumErrorFreeThroughput *prometheus.Desc
-	upstreamMinimumErrorFreeThroughput   *prometheus.Desc
-	downstreamBitswapEnabled             *prometheus.Desc
-	upstreamBitswapEnabled               *prometheus.Desc
-	downstreamSeamlessRateAdaption       *prometheus.Desc
-	upstreamSeamlessRateAdaption         *prometheus.Desc
-	downstreamInterleavingDelay          *prometheus.Desc
-	upstreamInterleavingDelay            *prometheus.Desc
-	downstreamImpulseNoiseProtection     *prometheus.Desc
-	upstreamImpulseNoiseProtection       *prometheus.Desc
-	downstreamRetransmissionEnabled      *prometheus.Desc
-	upstreamRetransmissionEnabled        *prometheus.Desc
-	downstreamVectoringState             *prometheus.Desc
-	upstreamVectoringState               *prometheus.Desc
-	downstreamAttenuation                *prometheus.Desc
-	upstreamAttenuation                  *prometheus.Desc
-	downstreamSNRMargin                  *prometheus.Desc
-	upstreamSNRMargin                    *prometheus.Desc
-	downstreamPower                      *prometheus.Desc
-	upstreamPower                        *prometheus.Desc
-	downstreamRTXTXCount                 *prometheus.Desc
-	upstreamRTXTXCount                   *prometheus.Desc
-	downstreamRTXCCount                  *prometheus.Desc
-	upstreamRTXCCount                    *prometheus.Desc
-	downstreamRTXUCCount                 *prometheus.Desc
-	upstreamRTXUCCount                   *prometheus.Desc
-	downstreamFECCount                   *prometheus.Desc
-	upstreamFECCount                     *prometheus.Desc
-	downstreamCRCCount                   *prometheus.Desc
-	upstreamCRCCount                     *prometheus.Desc
-	downstreamESCount                    *prometheus.Desc
-	upstreamESCount                      *prometheus.Desc
-	downstreamSESCount                   *prometheus.Desc
-	upstreamSESCount                     *prometheus.Desc
-
-	// via rtop
-	rtopInfo         *prometheus.Desc
-	rtopLoad1        *prometheus.Desc
-	rtopLoad5        *prometheus.Desc
-	rtopLoad15       *prometheus.Desc
-	rtopLoadRunning  *prometheus.Desc
-	rtopLoadTotal    *prometheus.Desc
-	rtopCPUUser      *prometheus.Desc
-	rtopCPUSystem    *prometheus.Desc
-	rtopCPUNice      *prometheus.Desc
-	rtopCPUIdle      *prometheus.Desc
-	rtopCPUIOWait    *prometheus.Desc
-	rtopCPUIRQ       *prometheus.Desc
-	rtopCPUSoftIRQ   *prometheus.Desc
-	rtopCPUSteal     *prometheus.Desc
-	rtopCPUGuest     *prometheus.Desc
-	rtopMEMTotal     *prometheus.Desc
-	rtopMEMFree      *prometheus.Desc
-	rtopMEMUsed      *prometheus.Desc
-	rtopMEMBuffers   *prometheus.Desc
-	rtopMEMCached    *prometheus.Desc
-	rtopMEMSwapFree  *prometheus.Desc
-	rtopMEMSwapTotal *prometheus.Desc
-	rtopFSTotal      *prometheus.Desc
-	rtopFSUsed       *prometheus.Desc
-	rtopFSFree       *prometheus.Desc
-	rtopNETRx        *prometheus.Desc
-	rtopNETTx        *prometheus.Desc
+	// dslDescs and legacyDescs are indexed like dslMetrics; legacyDescs is
+	// empty unless the deprecated metrics with a unit label are enabled.
+	dslDescs                 []*prometheus.Desc
+	legacyDescs              []*prometheus.Desc
+	state                    *prometheus.Desc
+	mode                     *prometheus.Desc
+	modeInfo                 *prometheus.Desc
+	uptime                   *prometheus.Desc
+	lastSync                 *prometheus.Desc
+	farEndInventory          *prometheus.Desc
+	nearEndInventory         *prometheus.Desc
+	downstreamVectoringState *prometheus.Desc
+	upstreamVectoringState   *prometheus.Desc
+	errorTotals              map[string]*prometheus.Desc
+	// binDescs, bandDescs, contractDescs and lineEventDescs are indexed like
+	// binMetrics, bandMetrics, contractMetrics and lineEventMetrics.
+	binDescs           []*prometheus.Desc
+	bandDescs          []*prometheus.Desc
+	contractDescs      []*prometheus.Desc
+	lineEventDescs     []*prometheus.Desc
+	reconnectAttempts  *prometheus.Desc
+	reconnectSuccesses *prometheus.Desc
+
+	snapshotAge        *prometheus.Desc
+	collectorUp        *prometheus.Desc
+	collectorDuration  *prometheus.Desc
+	lastSuccessfulPoll *prometheus.Desc
+	collectorErrors    *prometheus.CounterVec
+	invalidSamples     *prometheus.CounterVec
+	coalescedScrapes   prometheus.Counter
+
+	// rawDataRules extract metrics from the raw data of go-dsl.
+	rawDataRules []regexRule
+
+	// commands are run on the modem over the SSH connection of rtop.
+	commands     []command
+	commandDescs *descCache
+
+	// via rtop, indexed like rtopMetrics
+	rtopDescs []*prometheus.Desc
 }
 
-func New(dsl dsl.Client, rtop *rtop.Client, logger log.Logger) *Exporter {
-	return &Exporter{
-		dsl:    dsl,
-		rtop:   rtop,
-		logger: logger,
-		state: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "state"),
-			"State of the DSL modem.",
+func New(cfg config.Config, dsl *dsl.SupervisedClient, rtop *rtop.Client, logger log.Logger) *Exporter {
+	constLabels := targetLabels(cfg)
+
+	namespace := cfg.Namespace
+	if namespace == "" {
+		namespace = Namespace
+	}
+
+	descs := newDescTable()
+
+	e := &Exporter{
+		rtop:           rtop,
+		logger:         logger,
+		pollInterval:   cfg.PollInterval,
+		maxStaleness:   cfg.MaxStaleness,
+		dslTimeout:     cfg.DslTimeout,
+		rtopTimeout:    cfg.RtopTimeout,
+		coalesceWindow: cfg.CoalesceWindow,
+		binsGroupSize:  cfg.DslBinsGroupSize,
+		contract:       cfg.TargetContract,
+		dslBusy:        make(chan struct{}, 1),
+		rtopBusy:       make(chan struct{}, 1),
+		commandBusy:    make(chan struct{}, 1),
+		lastRefresh:    make(map[pollPlan]time.Time),
+		polling:        make(map[string]time.Time),
+		filter:         newFilter(cfg.Filter),
+		descs:          descs,
+		snapshot: snapshot{
+			polls: make(map[string]pollStatus),
+		},
+		accumulator:    newAccumulator(),
+		dslDescs:       newDslDescs(descs, namespace, constLabels),
+		rtopDescs:      newRtopDescs(descs, namespace, constLabels),
+		errorTotals:    newErrorCounterDescs(descs, namespace, constLabels),
+		binDescs:       newBinDescs(descs, namespace, constLabels),
+		bandDescs:      newBandDescs(descs, namespace, constLabels),
+		contractDescs:  newContractDescs(descs, namespace, constLabels),
+		lineEventDescs: newLineEventDescs(descs, namespace, constLabels),
+		collectorUp: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemScrape, "collector_up"),
+			"Whether the last poll of the collector succeeded.",
+			[]string{"collector"},
+			constLabels,
+		),
+		collectorDuration: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemScrape, "collector_duration_seconds"),
+			"Duration of the last poll of the collector.",
+			[]string{"collector"},
+			constLabels,
+		),
+		lastSuccessfulPoll: descs.new(
+			prometheus.BuildFQName(namespace, "", "last_successful_update_timestamp_seconds"),
+			"Unix timestamp of the last successful poll of the collector.",
+			[]string{"collector"},
+			constLabels,
+		),
+		collectorErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   SubsystemScrape,
+			Name:        "collector_errors_total",
+			Help:        "Total number of failed polls of the collector by error class.",
+			ConstLabels: constLabels,
+		}, []string{"collector", "class"}),
+		invalidSamples: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "invalid_samples_total",
+			Help:        "Total number of samples that were skipped because they could not be built.",
+			ConstLabels: constLabels,
+		}, []string{"metric"}),
+		coalescedScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   SubsystemScrape,
+			Name:        "coalesced_total",
+			Help:        "Total number of scrapes that shared the poll of another scrape.",
+			ConstLabels: constLabels,
+		}),
+		snapshotAge: descs.new(
+			prometheus.BuildFQName(namespace, "", "snapshot_age_seconds"),
+			"Age of the latest data polled from the modem.",
+			[]string{"collector"},
+			constLabels,
+		),
+		state: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, "state"),
+			"State of the DSL modem, 1 for the current state and 0 for all others.",
 			[]string{"state"},
-			nil,
+			constLabels,
 		),
-		mode: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "mode"),
-			"Mode of the DSL modem.",
+		mode: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, "mode"),
+			"Mode of the DSL modem, 1 for the current mode and 0 for all others.",
 			[]string{"mode"},
+			constLabels,
+		),
+		modeInfo: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, "mode_info"),
+			"Mode of the DSL modem including its profile or annex, as reported by go-dsl.",
+			[]string{"mode"},
+			constLabels,
+		),
+		uptime: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, "uptime_seconds"),
+			"Time since the DSL line was synchronized.",
 			nil,
+			constLabels,
 		),
-		uptime: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "uptime"),
-			"Uptime of the DSL modem.",
-			[]string{"uptime"},
+		lastSync: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, "last_sync_timestamp_seconds"),
+			"Unix timestamp of the last synchronization of the DSL line.",
 			nil,
+			constLabels,
 		),
-		farEndInventory: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "modem_manufacturer_far"),
+		farEndInventory: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, "modem_manufacturer_far"),
 			"Far end inventory name of the manufacturer",
 			[]string{"vendor", "version"},
-			nil,
+			constLabels,
 		),
-		nearEndInventory: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "modem_manufacturer_near"),
+		nearEndInventory: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, "modem_manufacturer_near"),
 			"Near end inventory name of the manufacturer.",
 			[]string{"vendor", "version"},
-			nil,
-		),
-		downstreamActualRate: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "actual_rate_downstream"),
-			"Actual rate of downstream.",
-			[]string{"unit"},
-			nil,
-		),
-		upstreamActualRate: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "actual_rate_upstream"),
-			"Actual rate of upstream.",
-			[]string{"unit"},
-			nil,
-		),
-		downstreamAttainableRate: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "attainable_rate_downstream"),
-			"Attainable rate of downstream.",
-			[]string{"unit"},
-			nil,
-		),
-		upstreamAttainableRate: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "attainable_rate_upstream"),
-			"Attainable rate of upstream.",
-			[]string{"unit"},
-			nil,
-		),
-		downstreamMinimumErrorFreeThroughput: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "minimum_error_free_throughput_downstream"),
-			"Minimum error free throughput of downstream.",
-			[]string{"unit"},
-			nil,
-		),
-		upstreamMinimumErrorFreeThroughput: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "minimum_error_free_throughput_upstream"),
-			"Minimum error free throughput of upstream.",
-			[]string{"unit"},
-			nil,
-		),
-		downstreamBitswapEnabled: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "bitswap_enabled_downstream"),
-			"Bitswap enabled of downstream.",
-			nil,
-			nil,
-		),
-		upstreamBitswapEnabled: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "bitswap_enabled_upstream"),
-			"Bitswap enabled of upstream.",
-			nil,
-			nil,
-		),
-		downstreamSeamlessRateAdaption: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "seamless_rate_adaption_downstream"),
-			"Seamless rate adaption of downstream.",
-			nil,
-			nil,
-		),
-		upstreamSeamlessRateAdaption: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "seamless_rate_adaption_upstream"),
-			"Seamless rate adaption of upstream.",
-			nil,
-			nil,
+			constLabels,
 		),
-		downstreamInterleavingDelay: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "interleaving_delay_downstream"),
-			"Interleaving delay of downstream.",
-			[]string{"unit"},
-			nil,
-		),
-		upstreamInterleavingDelay: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "interleaving_delay_upstream"),
-			"Interleaving delay of upstream.",
-			[]string{"unit"},
-			nil,
-		),
-		downstreamImpulseNoiseProtection: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "impulse_noise_protection_downstream"),
-			"Impulse noise protection of downstream.",
-			[]string{"unit"},
-			nil,
-		),
-		upstreamImpulseNoiseProtection: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "impulse_noise_protection_upstream"),
-			"Impulse noise protection of upstream.",
-			[]string{"unit"},
-			nil,
-		),
-		downstreamRetransmissionEnabled: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "retransmission_enabled_downstream"),
-			"Retransmission enabled of downstream.",
-			nil,
-			nil,
-		),
-		upstreamRetransmissionEnabled: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "retransmission_enabled_upstream"),
-			"Retransmission enabled of upstream.",
-			nil,
-			nil,
-		),
-		downstreamVectoringState: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "vectoring_state_downstream"),
-			"Vectoring state of downstream.",
+		downstreamVectoringState: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, "vectoring_state_downstream"),
+			"Vectoring state of downstream, 1 for the current state and 0 for all others.",
 			[]string{"state"},
-			nil,
+			constLabels,
 		),
-		upstreamVectoringState: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "vectoring_state_upstream"),
-			"Vectoring state of upstream.",
+		upstreamVectoringState: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, "vectoring_state_upstream"),
+			"Vectoring state of upstream, 1 for the current state and 0 for all others.",
 			[]string{"state"},
-			nil,
+			constLabels,
 		),
-		downstreamAttenuation: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "attenuation_downstream"),
-			"Attenuation of downstream.",
-			[]string{"unit"},
+		reconnectAttempts: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, "reconnect_attempts_total"),
+			"Total number of attempts to connect to the DSL modem.",
 			nil,
+			constLabels,
 		),
-		upstreamAttenuation: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "attenuation_upstream"),
-			"Attenuation of upstream.",
-			[]string{"unit"},
+		reconnectSuccesses: descs.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, "reconnect_successes_total"),
+			"Total number of successful connections to the DSL modem.",
 			nil,
+			constLabels,
 		),
-		downstreamSNRMargin: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "snr_margin_downstream"),
-			"SNR margin of downstream.",
-			[]string{"unit"},
-			nil,
-		),
-		upstreamSNRMargin: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "snr_margin_upstream"),
-			"SNR margin of upstream.",
-			[]string{"unit"},
-			nil,
-		),
-		downstreamPower: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "power_downstream"),
-			"Power of downstream.",
-			[]string{"unit"},
-			nil,
-		),
-		upstreamPower: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "power_upstream"),
-			"Power of upstream.",
-			[]string{"unit"},
-			nil,
-		),
-		downstreamRTXTXCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "rtxtx_count_downstream"),
-			"RTTX TX count of downstream.",
-			nil,
-			nil,
-		),
-		upstreamRTXTXCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "rtxtx_count_upstream"),
-			"RTTX TX count of upstream.",
-			nil,
-			nil,
-		),
-		downstreamRTXCCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "rtxcc_count_downstream"),
-			"RTXCC count of downstream.",
-			nil,
-			nil,
-		),
-		upstreamRTXCCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "rtxcc_count_upstream"),
-			"RTXCC count of upstream.",
-			nil,
-			nil,
-		),
-		downstreamRTXUCCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "rtxucc_count_downstream"),
-			"RTXUCC count of downstream.",
-			nil,
-			nil,
-		),
-		upstreamRTXUCCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "rtxucc_count_upstream"),
-			"RTXUCC count of upstream.",
-			nil,
-			nil,
-		),
-		downstreamFECCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "fec_count_downstream"),
-			"FEC count of downstream.",
-			nil,
-			nil,
-		),
-		upstreamFECCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "fec_count_upstream"),
-			"FEC count of upstream.",
-			nil,
-			nil,
-		),
-		downstreamCRCCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "crc_count_downstream"),
-			"CRC count of downstream.",
-			nil,
-			nil,
-		),
-		upstreamCRCCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "crc_count_upstream"),
-			"CRC count of upstream.",
-			nil,
-			nil,
-		),
-		downstreamESCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "es_count_downstream"),
-			"ES count of downstream.",
-			nil,
-			nil,
-		),
-		upstreamESCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "es_count_upstream"),
-			"ES count of upstream.",
-			nil,
-			nil,
-		),
-		downstreamSESCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "ses_count_downstream"),
-			"SES count of downstream.",
-			nil,
-			nil,
-		),
-		upstreamSESCount: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemDsl, "ses_count_upstream"),
-			"SES count of upstream.",
-			nil,
-			nil,
-		),
-		// rtop
-		rtopInfo: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "info"),
-			"Information about the host.",
-			[]string{"hostname", "uptime"},
-			nil,
-		),
-		rtopLoad1: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "load1"),
-			"Load1 of the host.",
-			nil,
-			nil,
-		),
-		rtopLoad5: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "load5"),
-			"Load5 of the host.",
-			nil,
-			nil,
-		),
-		rtopLoad15: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "load15"),
-			"Load15 of the host.",
-			nil,
-			nil,
-		),
-		rtopLoadTotal: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "load_total"),
-			"LoadTotal of the host.",
-			nil,
-			nil,
-		),
-		rtopLoadRunning: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "load_running"),
-			"LoadRunning of the host.",
-			nil,
-			nil,
-		),
-		rtopCPUUser: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "cpu_user"),
-			"CPU user of the host.",
-			nil,
-			nil,
-		),
-		rtopCPUSystem: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "cpu_system"),
-			"CPU system of the host.",
-			nil,
-			nil,
-		),
-		rtopCPUNice: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "cpu_nice"),
-			"CPU nice of the host.",
-			nil,
-			nil,
-		),
-		rtopCPUIdle: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "cpu_idle"),
-			"CPU idle of the host.",
-			nil,
-			nil,
-		),
-		rtopCPUIOWait: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "cpu_iowait"),
-			"CPU iowait of the host.",
-			nil,
-			nil,
-		),
-		rtopCPUIRQ: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "cpu_irq"),
-			"CPU irq of the host.",
-			nil,
-			nil,
-		),
-		rtopCPUSoftIRQ: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "cpu_softirq"),
-			"CPU softirq of the host.",
-			nil,
-			nil,
-		),
-		rtopCPUSteal: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "cpu_steal"),
-			"CPU steal of the host.",
-			nil,
-			nil,
-		),
-		rtopCPUGuest: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "cpu_guest"),
-			"CPU guest of the host.",
-			nil,
-			nil,
-		),
-		rtopMEMTotal: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "mem_total"),
-			"Total memory of the host.",
-			nil,
-			nil,
-		),
-		rtopMEMFree: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "mem_free"),
-			"Free memory of the host.",
-			nil,
-			nil,
-		),
-		rtopMEMUsed: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "mem_used"),
-			"Used memory of the host.",
-			nil,
-			nil,
-		),
-		rtopMEMBuffers: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "mem_buffers"),
-			"Buffers memory of the host.",
-			nil,
-			nil,
-		),
-		rtopMEMCached: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "mem_cached"),
-			"Cached memory of the host.",
-			nil,
+	}
 
-			nil,
-		),
-		rtopMEMSwapFree: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "mem_swap_free"),
-			"Free swap memory of the host.",
-			nil,
-			nil,
-		),
-		rtopMEMSwapTotal: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "mem_swap_total"),
-			"Total swap memory of the host.",
-			nil,
-			nil,
-		),
-		rtopFSTotal: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "fs_total"),
-			"Total filesystems of the host.",
-			[]string{"mount"},
-			nil,
-		),
-		rtopFSUsed: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "fs_used"),
-			"Used filesystem of the host.",
-			[]string{"mount"},
-			nil,
-		),
-		rtopFSFree: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "fs_free"),
-			"Free filesystem of the host.",
-			[]string{"mount"},
-			nil,
-		),
-		rtopNETRx: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "net_rx"),
-			"Total received bytes of the network.",
-			[]string{"interface", "ipv4", "ipv6"},
-			nil,
-		),
-		rtopNETTx: prometheus.NewDesc(
-			prometheus.BuildFQName(Namespace, SubsystemRtop, "net_tx"),
-			"Total transmitted bytes of the network.",
-			[]string{"interface", "ipv4", "ipv6"},
-			nil,
-		),
+	if cfg.LegacyMetrics {
+		e.legacyDescs = newLegacyDescs(descs, namespace, constLabels)
+	}
+
+	e.rawDataRules = newRegexRules(descs, cfg.RawDataRules, func(name string) string {
+		return prometheus.BuildFQName(namespace, SubsystemDsl, "raw_"+name)
+	}, "Value extracted from the raw data of the DSL modem.", constLabels)
+
+	e.commands = newCommands(descs, cfg.Commands, cfg.RtopTimeout, namespace, constLabels)
+	e.commandDescs = newDescCache(descs, namespace, constLabels)
+
+	// A nil client is left out, so that e.dsl stays a nil interface.
+	if dsl != nil {
+		e.dsl = dsl
 	}
+
+	e.collectors = e.filter.collectors(newCollectors(e, cfg.Collectors), descs)
+	e.plan = planFor(e.collectors)
+
+	return e
 }
 
 func (e *Exporter) Describe(descs chan<- *prometheus.Desc) {
-	// dsl
-	descs <- e.state
-	descs <- e.mode
-	descs <- e.uptime
-	descs <- e.farEndInventory
-	descs <- e.nearEndInventory
-	descs <- e.downstreamActualRate
-	descs <- e.upstreamActualRate
-	descs <- e.downstreamAttainableRate
-	descs <- e.upstreamActualRate
-	descs <- e.downstreamMinimumErrorFreeThroughput
-	descs <- e.upstreamMinimumErrorFreeThroughput
-	descs <- e.downstreamBitswapEnabled
-	descs <- e.upstreamBitswapEnabled
-	descs <- e.downstreamSeamlessRateAdaption
-	descs <- e.upstreamSeamlessRateAdaption
-	descs <- e.downstreamInterleavingDelay
-	descs <- e.upstreamInterleavingDelay
-	descs <- e.downstreamImpulseNoiseProtection
-	descs <- e.upstreamImpulseNoiseProtection
-	descs <- e.downstreamRetransmissionEnabled
-	descs <- e.upstreamRetransmissionEnabled
-	descs <- e.downstreamVectoringState
-	descs <- e.upstreamVectoringState
-	descs <- e.downstreamAttenuation
-	descs <- e.upstreamAttenuation
-	descs <- e.downstreamSNRMargin
-	descs <- e.upstreamSNRMargin
-	descs <- e.downstreamPower
-	descs <- e.upstreamPower
-	descs <- e.downstreamRTXTXCount
-	descs <- e.upstreamRTXTXCount
-	descs <- e.downstreamRTXCCount
-	descs <- e.upstreamRTXCCount
-	descs <- e.downstreamRTXUCCount
-	descs <- e.upstreamRTXUCCount
-	descs <- e.downstreamFECCount
-	descs <- e.upstreamFECCount
-	descs <- e.downstreamCRCCount
-	descs <- e.upstreamCRCCount
-	descs <- e.downstreamESCount
-	descs <- e.upstreamESCount
-	descs <- e.downstreamSESCount
-	descs <- e.upstreamSESCount
-
-	// rtop
-	descs <- e.rtopInfo
-	descs <- e.rtopLoad1
-	descs <- e.rtopLoad5
-	descs <- e.rtopLoad15
-	descs <- e.rtopLoadRunning
-	descs <- e.rtopLoadTotal
-	descs <- e.rtopCPUUser
-	descs <- e.rtopCPUSystem
-	descs <- e.rtopCPUNice
-	descs <- e.rtopCPUIdle
-	descs <- e.rtopCPUIOWait
-	descs <- e.rtopCPUIRQ
-	descs <- e.rtopCPUSoftIRQ
-	descs <- e.rtopCPUSteal
-	descs <- e.rtopCPUGuest
-	descs <- e.rtopMEMTotal
-	descs <- e.rtopMEMFree
-	descs <- e.rtopMEMUsed
-	descs <- e.rtopMEMBuffers
-	descs <- e.rtopMEMCached
-	descs <- e.rtopMEMSwapFree
-	descs <- e.rtopMEMSwapTotal
-	descs <- e.rtopFSTotal
-	descs <- e.rtopFSUsed
-	descs <- e.rtopFSFree
-	descs <- e.rtopNETRx
-	descs <- e.rtopNETTx
+	for _, c := range e.collectors {
+		c.Describe(descs)
+	}
+
+	descs <- e.reconnectAttempts
+	descs <- e.reconnectSuccesses
+	descs <- e.snapshotAge
+	descs <- e.collectorUp
+	descs <- e.collectorDuration
+	descs <- e.lastSuccessfulPoll
+	e.collectorErrors.Describe(descs)
+	e.invalidSamples.Describe(descs)
+	e.coalescedScrapes.Describe(descs)
 }
 
 func (e *Exporter) Collect(metrics chan<- prometheus.Metric) {
+	e.collect(context.Background(), e.collectors, metrics)
+}
+
+// collect emits the metrics of the given collectors, polling the modem for
+// them first unless it is polled in the background.
+func (e *Exporter) collect(ctx context.Context, collectors []namedCollector, metrics chan<- prometheus.Metric) {
 	level.Debug(e.logger).Log("msg", "collecting metrics...")
 
-	if err := e.getDataFromClients(metrics); err != nil {
-		level.Error(e.logger).Log("msg", "could not get data", "err", err.Error()) //nolint:errcheck
+	var pending map[string]pollStatus
+	if e.pollInterval <= 0 {
+		pending = e.refresh(ctx, planFor(collectors))
 	}
+
+	e.collectCached(collectors, pending, metrics)
 }
 
-func (e *Exporter) getDataFromClients(metrics chan<- prometheus.Metric) error {
-	if err := e.getDataFromDsl(metrics); err != nil {
-		return err
+// collectCached emits the latest snapshot of the given collectors without
+// polling the modem. Sources in pending are reported with the given status
+// instead of their last poll.
+func (e *Exporter) collectCached(collectors []namedCollector, pending map[string]pollStatus, metrics chan<- prometheus.Metric) {
+	e.collectSnapshot(collectors, pending, metrics)
+	e.collectorErrors.Collect(metrics)
+	e.invalidSamples.Collect(metrics)
+	e.coalescedScrapes.Collect(metrics)
+}
+
+// refresh polls the modem on behalf of a scrape. Scrapes that arrive while a
+// poll of the same plan is in flight, or within the coalesce window after it
+// finished, share its result instead of polling the modem again, so
+// concurrent scrapes never issue overlapping commands to the same client. A
+// scrape stops waiting for the poll when its own context is done; the sources
+// of the plan that are still being polled then are returned as failed, so the
+// scrape does not serve the data of an earlier poll for them.
+func (e *Exporter) refresh(ctx context.Context, plan pollPlan) map[string]pollStatus {
+	e.mu.RLock()
+	lastRefresh := e.lastRefresh[plan]
+	e.mu.RUnlock()
+
+	if e.coalesceWindow > 0 && time.Since(lastRefresh) < e.coalesceWindow {
+		e.coalescedScrapes.Inc()
+		return nil
+	}
+
+	var polled atomic.Bool
+	result := e.flight.DoChan(plan.String(), func() (interface{}, error) {
+		polled.Store(true)
+
+		// The poll is shared with the other scrapes waiting for it, so it
+		// must not be canceled with the scrape that started it. Each source
+		// is bounded by its own timeout instead, capped at the scrape
+		// timeout.
+		var scrapeTimeout time.Duration
+		if deadline, ok := ctx.Deadline(); ok {
+			scrapeTimeout = time.Until(deadline)
+		}
+		e.getDataFromClients(context.Background(), plan, scrapeTimeout)
+
+		e.mu.Lock()
+		e.lastRefresh[plan] = time.Now()
+		e.mu.Unlock()
+
+		return nil, nil
+	})
+
+	var pending map[string]pollStatus
+	select {
+	case <-result:
+	case <-ctx.Done():
+		pending = e.pending(plan, time.Now())
+	}
+
+	if !polled.Load() {
+		e.coalescedScrapes.Inc()
+	}
+
+	return pending
+}
+
+// pending returns the sources of the plan that are still being polled as
+// failed polls.
+func (e *Exporter) pending(plan pollPlan, now time.Time) map[string]pollStatus {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	pending := make(map[string]pollStatus)
+	for source, started := range e.polling {
+		if e.polls(plan, source) {
+			pending[source] = pollStatus{up: false, started: started, duration: now.Sub(started)}
+		}
+	}
+	return pending
+}
+
+// getDataFromClients polls every source of the plan concurrently, each with
+// its own deadline. Sources fail independently: an error or timeout in one of
+// them is reported and the others are still polled. Sources without a client
+// or left out of the plan are skipped. Timeouts are capped at maxTimeout, if
+// it is set, and sources without a timeout use it as their timeout.
+func (e *Exporter) getDataFromClients(ctx context.Context, plan pollPlan, maxTimeout time.Duration) {
+	var wg sync.WaitGroup
+
+	run := func(collector string, timeout time.Duration, busy chan struct{}, fn func(ctx context.Context) error) {
+		if maxTimeout > 0 && (timeout <= 0 || timeout > maxTimeout) {
+			timeout = maxTimeout
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = e.poll(ctx, collector, timeout, busy, fn)
+		}()
+	}
+
+	if e.pollsDsl(plan) {
+		run(SubsystemDsl, e.dslTimeout, e.dslBusy, func(ctx context.Context) error { return e.getDataFromDsl(ctx, plan.dslBins) })
+	}
+	if e.pollsRtop(plan) {
+		run(SubsystemRtop, e.rtopTimeout, e.rtopBusy, func(context.Context) error { return e.getDataFromRtop(plan.rtopStats) })
+	}
+	if e.pollsCommands(plan) {
+		run(SubsystemCommand, commandsTimeout(e.commands), e.commandBusy, func(context.Context) error { return e.getDataFromCommands() })
+	}
+
+	wg.Wait()
+}
+
+// withDeadline runs fn until it returns or the source's deadline expires. fn
+// is passed the deadline, but neither go-dsl nor rtop accept a context, so fn
+// runs in its own goroutine and may keep running in the background after a
+// timeout; busy guards the source until then.
+func withDeadline(ctx context.Context, timeout time.Duration, busy chan struct{}, fn func(ctx context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	errc := make(chan error, 1)
+
+	select {
+	case busy <- struct{}{}:
+		go func() {
+			defer func() { <-busy }()
+			errc <- fn(ctx)
+		}()
+	case <-ctx.Done():
+		errc <- ctx.Err()
 	}
-	if err := e.getDataFromRtop(metrics); err != nil {
+
+	select {
+	case err := <-errc:
 		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	return nil
 }
 
-func (e *Exporter) getDataFromDsl(metrics chan<- prometheus.Metric) error {
-	if err := e.dsl.UpdateData(); err != nil {
+// getDataFromDsl polls the DSL status, and the per-tone data if bins is set.
+// The per-tone data of the previous poll is kept otherwise. The session is torn
+// down if the poll does not finish before ctx is done.
+func (e *Exporter) getDataFromDsl(ctx context.Context, bins bool) error {
+	if err := e.dsl.UpdateData(ctx); err != nil {
 		return err
 	}
 
 	status := e.dsl.Status()
 
-	metrics <- prometheus.MustNewConstMetric(e.state, prometheus.UntypedValue, 1, status.State.String())
-	metrics <- prometheus.MustNewConstMetric(e.mode, prometheus.UntypedValue, 1, status.Mode.String())
-	metrics <- prometheus.MustNewConstMetric(e.uptime, prometheus.UntypedValue, 1, status.Uptime.String())
-	metrics <- prometheus.MustNewConstMetric(e.farEndInventory, prometheus.UntypedValue, 1, status.FarEndInventory.Vendor, status.FarEndInventory.Version)
-	metrics <- prometheus.MustNewConstMetric(e.nearEndInventory, prometheus.UntypedValue, 1, status.NearEndInventory.Vendor, status.NearEndInventory.Version)
-	metrics <- prometheus.MustNewConstMetric(e.downstreamActualRate, prometheus.GaugeValue, float64(status.DownstreamActualRate.Int), status.DownstreamActualRate.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.upstreamActualRate, prometheus.GaugeValue, float64(status.UpstreamActualRate.Int), status.UpstreamActualRate.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.downstreamAttainableRate, prometheus.GaugeValue, float64(status.DownstreamAttainableRate.Int), status.DownstreamAttainableRate.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.upstreamAttainableRate, prometheus.GaugeValue, float64(status.UpstreamAttainableRate.Int), status.UpstreamAttainableRate.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.downstreamMinimumErrorFreeThroughput, prometheus.GaugeValue, float64(status.DownstreamMinimumErrorFreeThroughput.Int), status.DownstreamMinimumErrorFreeThroughput.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.upstreamMinimumErrorFreeThroughput, prometheus.GaugeValue, float64(status.UpstreamMinimumErrorFreeThroughput.Int), status.UpstreamMinimumErrorFreeThroughput.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.downstreamBitswapEnabled, prometheus.GaugeValue, boolToFloat64(status.DownstreamBitswapEnabled.Bool))
-	metrics <- prometheus.MustNewConstMetric(e.upstreamBitswapEnabled, prometheus.GaugeValue, boolToFloat64(status.UpstreamBitswapEnabled.Bool))
-	metrics <- prometheus.MustNewConstMetric(e.downstreamSeamlessRateAdaption, prometheus.GaugeValue, boolToFloat64(status.DownstreamSeamlessRateAdaption.Bool))
-	metrics <- prometheus.MustNewConstMetric(e.upstreamSeamlessRateAdaption, prometheus.GaugeValue, boolToFloat64(status.UpstreamSeamlessRateAdaption.Bool))
-	metrics <- prometheus.MustNewConstMetric(e.downstreamInterleavingDelay, prometheus.GaugeValue, status.DownstreamInterleavingDelay.Float, status.DownstreamInterleavingDelay.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.upstreamInterleavingDelay, prometheus.GaugeValue, status.UpstreamInterleavingDelay.Float, status.UpstreamInterleavingDelay.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.downstreamImpulseNoiseProtection, prometheus.GaugeValue, status.DownstreamImpulseNoiseProtection.Float, status.DownstreamImpulseNoiseProtection.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.upstreamImpulseNoiseProtection, prometheus.GaugeValue, status.UpstreamImpulseNoiseProtection.Float, status.UpstreamImpulseNoiseProtection.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.downstreamRetransmissionEnabled, prometheus.GaugeValue, boolToFloat64(status.DownstreamRetransmissionEnabled.Bool))
-	metrics <- prometheus.MustNewConstMetric(e.upstreamRetransmissionEnabled, prometheus.GaugeValue, boolToFloat64(status.UpstreamRetransmissionEnabled.Bool))
-	metrics <- prometheus.MustNewConstMetric(e.downstreamVectoringState, prometheus.GaugeValue, 1, status.DownstreamVectoringState.Value())
-	metrics <- prometheus.MustNewConstMetric(e.upstreamVectoringState, prometheus.GaugeValue, 1, status.UpstreamVectoringState.Value())
-	metrics <- prometheus.MustNewConstMetric(e.downstreamAttenuation, prometheus.GaugeValue, status.DownstreamAttenuation.Float, status.DownstreamAttenuation.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.upstreamAttenuation, prometheus.GaugeValue, status.UpstreamAttenuation.Float, status.UpstreamAttenuation.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.downstreamSNRMargin, prometheus.GaugeValue, status.DownstreamSNRMargin.Float, status.DownstreamSNRMargin.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.upstreamSNRMargin, prometheus.GaugeValue, status.UpstreamSNRMargin.Float, status.UpstreamSNRMargin.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.downstreamPower, prometheus.GaugeValue, status.DownstreamPower.Float, status.DownstreamPower.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.upstreamPower, prometheus.GaugeValue, status.UpstreamPower.Float, status.UpstreamPower.Unit())
-	metrics <- prometheus.MustNewConstMetric(e.downstreamRTXTXCount, prometheus.GaugeValue, float64(status.DownstreamRTXTXCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.upstreamRTXTXCount, prometheus.GaugeValue, float64(status.UpstreamRTXTXCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.downstreamRTXCCount, prometheus.GaugeValue, float64(status.DownstreamRTXCCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.upstreamRTXCCount, prometheus.GaugeValue, float64(status.UpstreamRTXCCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.downstreamRTXUCCount, prometheus.GaugeValue, float64(status.DownstreamRTXUCCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.upstreamRTXUCCount, prometheus.GaugeValue, float64(status.UpstreamRTXUCCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.downstreamFECCount, prometheus.GaugeValue, float64(status.DownstreamFECCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.upstreamFECCount, prometheus.GaugeValue, float64(status.UpstreamFECCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.downstreamCRCCount, prometheus.GaugeValue, float64(status.DownstreamCRCCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.upstreamCRCCount, prometheus.GaugeValue, float64(status.UpstreamCRCCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.downstreamESCount, prometheus.GaugeValue, float64(status.DownstreamESCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.upstreamESCount, prometheus.GaugeValue, float64(status.UpstreamESCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.downstreamSESCount, prometheus.GaugeValue, float64(status.DownstreamSESCount.Int))
-	metrics <- prometheus.MustNewConstMetric(e.upstreamSESCount, prometheus.GaugeValue, float64(status.UpstreamSESCount.Int))
+	var data models.Bins
+	if bins {
+		data = e.dsl.Bins()
+	}
+
+	var raw []byte
+	if len(e.rawDataRules) > 0 {
+		raw = e.dsl.RawData()
+	}
+
+	totals := e.accumulator.observe(status)
+	events := e.lineTracker.observe(status, time.Now())
+
+	e.mu.Lock()
+	e.snapshot.status = status
+	e.snapshot.rawData = raw
+	if bins {
+		e.snapshot.bins = data
+	}
+	e.snapshot.errorTotals = totals
+	e.snapshot.lineEvents = events
+	e.snapshot.dslUpdated = time.Now()
+	e.mu.Unlock()
 
 	return nil
 }
 
-func (e *Exporter) getDataFromRtop(metrics chan<- prometheus.Metric) error {
-	stats, err := e.rtop.GetStats()
+// getDataFromRtop polls the selected parts of the system stats and keeps the
+// other parts of the previous polls.
+func (e *Exporter) getDataFromRtop(parts rtop.Stat) error {
+	stats, err := e.rtop.GetStats(parts)
 	if err != nil {
 		return err
 	}
 
-	metrics <- prometheus.MustNewConstMetric(e.rtopInfo, prometheus.GaugeValue, 1, stats.Hostname, stats.Uptime.String())
+	e.mu.Lock()
+	rtop.MergeStats(&e.snapshot.stats, stats, parts)
+	e.snapshot.rtopUpdated = time.Now()
+	e.mu.Unlock()
 
-	metrics <- prometheus.MustNewConstMetric(e.rtopLoad1, prometheus.GaugeValue, stringToFloat64(stats.Loads.Load1))
-	metrics <- prometheus.MustNewConstMetric(e.rtopLoad5, prometheus.GaugeValue, stringToFloat64(stats.Loads.Load5))
-	metrics <- prometheus.MustNewConstMetric(e.rtopLoad15, prometheus.GaugeValue, stringToFloat64(stats.Loads.Load15))
-	metrics <- prometheus.MustNewConstMetric(e.rtopLoadRunning, prometheus.GaugeValue, stringToFloat64(stats.Loads.RunningProcs))
-	metrics <- prometheus.MustNewConstMetric(e.rtopLoadTotal, prometheus.GaugeValue, stringToFloat64(stats.Loads.TotalProcs))
+	return nil
+}
 
-	metrics <- prometheus.MustNewConstMetric(e.rtopCPUUser, prometheus.GaugeValue, float64(stats.CPU.User))
-	metrics <- prometheus.MustNewConstMetric(e.rtopCPUSystem, prometheus.GaugeValue, float64(stats.CPU.System))
-	metrics <- prometheus.MustNewConstMetric(e.rtopCPUNice, prometheus.GaugeValue, float64(stats.CPU.Nice))
-	metrics <- prometheus.MustNewConstMetric(e.rtopCPUIdle, prometheus.GaugeValue, float64(stats.CPU.Idle))
-	metrics <- prometheus.MustNewConstMetric(e.rtopCPUIOWait, prometheus.GaugeValue, float64(stats.CPU.IOWait))
-	metrics <- prometheus.MustNewConstMetric(e.rtopCPUIRQ, prometheus.GaugeValue, float64(stats.CPU.IRQ))
-	metrics <- prometheus.MustNewConstMetric(e.rtopCPUSoftIRQ, prometheus.GaugeValue, float64(stats.CPU.SoftIRQ))
-	metrics <- prometheus.MustNewConstMetric(e.rtopCPUSteal, prometheus.GaugeValue, float64(stats.CPU.Steal))
-	metrics <- prometheus.MustNewConstMetric(e.rtopCPUGuest, prometheus.GaugeValue, float64(stats.CPU.Guest))
+// collectDsl emits the DSL status that was polled at the given time.
+func (e *Exporter) collectDsl(status models.Status, updated time.Time, metrics chan<- prometheus.Metric) {
+	e.collectState(metrics, status.State)
+	e.collectModeType(metrics, status.Mode.Type)
+	if mode := status.Mode.String(); !isUnknown(mode) {
+		e.sample(metrics, e.modeInfo, prometheus.GaugeValue, 1, mode)
+	}
+	if uptime := status.Uptime.Duration; uptime > 0 {
+		e.sample(metrics, e.uptime, prometheus.GaugeValue, uptime.Seconds())
+		e.sample(metrics, e.lastSync, prometheus.GaugeValue, float64(updated.Add(-uptime).Unix()))
+	}
+	if !isUnknown(status.FarEndInventory.Vendor) {
+		e.sample(metrics, e.farEndInventory, prometheus.UntypedValue, 1, status.FarEndInventory.Vendor, status.FarEndInventory.Version)
+	}
+	if !isUnknown(status.NearEndInventory.Vendor) {
+		e.sample(metrics, e.nearEndInventory, prometheus.UntypedValue, 1, status.NearEndInventory.Vendor, status.NearEndInventory.Version)
+	}
+	e.collectVectoringState(metrics, e.downstreamVectoringState, status.DownstreamVectoringState)
+	e.collectVectoringState(metrics, e.upstreamVectoringState, status.UpstreamVectoringState)
+	e.collectDslMetrics(status, metrics)
+}
 
-	metrics <- prometheus.MustNewConstMetric(e.rtopMEMTotal, prometheus.GaugeValue, float64(stats.MEM.Total))
-	metrics <- prometheus.MustNewConstMetric(e.rtopMEMFree, prometheus.GaugeValue, float64(stats.MEM.Free))
-	metrics <- prometheus.MustNewConstMetric(e.rtopMEMUsed, prometheus.GaugeValue, float64(stats.MEM.Used()))
-	metrics <- prometheus.MustNewConstMetric(e.rtopMEMCached, prometheus.GaugeValue, float64(stats.MEM.Cached))
-	metrics <- prometheus.MustNewConstMetric(e.rtopMEMBuffers, prometheus.GaugeValue, float64(stats.MEM.Buffers))
-	metrics <- prometheus.MustNewConstMetric(e.rtopMEMSwapFree, prometheus.GaugeValue, float64(stats.MEM.SwapFree))
-	metrics <- prometheus.MustNewConstMetric(e.rtopMEMSwapTotal, prometheus.GaugeValue, float64(stats.MEM.SwapTotal))
+func (e *Exporter) collectReconnectStats(metrics chan<- prometheus.Metric) {
+	if e.dsl == nil {
+		return
+	}
 
-	e.calculateNET(stats, e.rtopNETRx, e.rtopNETTx, metrics)
-	e.calculateFS(stats, e.rtopFSTotal, e.rtopFSUsed, e.rtopFSFree, metrics)
+	attempts, successes := e.dsl.ReconnectStats()
 
-	return nil
+	metrics <- prometheus.MustNewConstMetric(e.reconnectAttempts, prometheus.CounterValue, float64(attempts))
+	metrics <- prometheus.MustNewConstMetric(e.reconnectSuccesses, prometheus.CounterValue, float64(successes))
 }
 
-func (e *Exporter) calculateNET(stats types.Stats, descRx *prometheus.Desc, descTx *prometheus.Desc, metrics chan<- prometheus.Metric) {
-	for k, v := range stats.NetInterface {
-		metrics <- prometheus.MustNewConstMetric(descRx, prometheus.GaugeValue, float64(v.Rx), k, v.IPv4, v.IPv6)
-		metrics <- prometheus.MustNewConstMetric(descTx, prometheus.GaugeValue, float64(v.Tx), k, v.IPv4, v.IPv6)
+func (e *Exporter) CloseClient() {
+	if e.dsl != nil {
+		e.dsl.Close()
+	}
+	if e.rtop != nil {
+		e.rtop.Close()
 	}
 }
 
-func (e *Exporter) calculateFS(stats types.Stats, descTotal *prometheus.Desc, descUsed *prometheus.Desc, descFree *prometheus.Desc, metrics chan<- prometheus.Metric) {
-	for _, fs := range stats.FSInfos {
-		metrics <- prometheus.MustNewConstMetric(descTotal, prometheus.GaugeValue, float64(fs.Total), fs.MountPoint)
-		metrics <- prometheus.MustNewConstMetric(descUsed, prometheus.GaugeValue, float64(fs.Used), fs.MountPoint)
-		metrics <- prometheus.MustNewConstMetric(descFree, prometheus.GaugeValue, float64(fs.Free), fs.MountPoint)
+// targetLabels returns the constant labels of every metric of the exporter:
+// the global labels of the config, overridden by the static labels of the
+// target, and the name of the target if it comes from the config file.
+func targetLabels(cfg config.Config) prometheus.Labels {
+	labels := make(prometheus.Labels, len(cfg.Labels)+len(cfg.TargetLabels)+1)
+	for name, value := range cfg.Labels {
+		labels[name] = value
+	}
+	// Target labels are padded with empty values, which must not hide the
+	// global value of a label.
+	for name, value := range cfg.TargetLabels {
+		if value != "" || labels[name] == "" {
+			labels[name] = value
+		}
+	}
+	if cfg.TargetName != "" {
+		labels[config.TargetLabel] = cfg.TargetName
 	}
-}
 
-func (e *Exporter) CloseClient() {
-	e.dsl.Close()
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
 }
 
 func boolToFloat64(b bool) float64 {
@@ -739,10 +607,39 @@ func boolToFloat64(b bool) float64 {
 	return 0
 }
 
+// stringToFloat64 parses s, returning NaN if it is not a number, so that the
+// sample is dropped instead of being reported as zero.
 func stringToFloat64(s string) float64 {
 	f, err := strconv.ParseFloat(s, 64)
 	if err != nil {
-		return 0
+		return math.NaN()
 	}
 	return f
 }
+
+// isUnknown reports whether go-dsl could not determine a string value.
+func isUnknown(s string) bool {
+	return s == "" || strings.EqualFold(s, "unknown")
+}
+
+// sample sends a metric built from the given value unless it is excluded by
+// the filter. Samples that cannot be built, e.g. due to a label mismatch or a
+// value that is not a number, are skipped and counted instead of failing the
+// whole scrape.
+func (e *Exporter) sample(metrics chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labelValues ...string) {
+	info := e.descs.info(desc)
+	if !e.filter.keep(info, labelValues) {
+		return
+	}
+
+	metric, err := prometheus.NewConstMetric(desc, valueType, value, labelValues...)
+	if err == nil && (math.IsNaN(value) || math.IsInf(value, 0)) {
+		err = fmt.Errorf("invalid value %v", value)
+	}
+	if err != nil {
+		e.invalidSamples.WithLabelValues(info.name).Inc()
+		level.Debug(e.logger).Log("msg", "skipping invalid sample", "metric", info.name, "err", err.Error()) //nolint:errcheck
+		return
+	}
+	metrics <- metric
+}
@@ -0,0 +1,215 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"3e8.eu/go/dsl/models"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rapidloop/rtop/pkg/types"
+
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+)
+
+// newTestExporter returns an exporter without clients, whose collectors are
+// fed with snapshots by the tests.
+func newTestExporter(cfg config.Config) *Exporter {
+	return New(cfg, nil, nil, log.NewNopLogger())
+}
+
+// collect returns the metrics sent by fn.
+func collect(fn func(metrics chan<- prometheus.Metric)) []prometheus.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		fn(ch)
+		close(ch)
+	}()
+
+	var metrics []prometheus.Metric
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+	return metrics
+}
+
+// sampleOf returns the value and the label values of a metric.
+func sampleOf(t *testing.T, m prometheus.Metric) (float64, map[string]string) {
+	t.Helper()
+
+	var pb dto.Metric
+	if err := m.Write(&pb); err != nil {
+		t.Fatalf("Write() = %v", err)
+	}
+
+	labels := make(map[string]string, len(pb.GetLabel()))
+	for _, pair := range pb.GetLabel() {
+		labels[pair.GetName()] = pair.GetValue()
+	}
+
+	switch {
+	case pb.Gauge != nil:
+		return pb.GetGauge().GetValue(), labels
+	case pb.Counter != nil:
+		return pb.GetCounter().GetValue(), labels
+	default:
+		return pb.GetUntyped().GetValue(), labels
+	}
+}
+
+func testStatus() models.Status {
+	rate := models.ValueBandwidth{IntValue: models.IntValue{Int: 100000, Valid: true}}
+	on := models.BoolValue{Bool: true, Valid: true}
+	delay := models.ValueMilliseconds{FloatValue: models.FloatValue{Float: 8, Valid: true}}
+	inp := models.ValueSymbols{FloatValue: models.FloatValue{Float: 2, Valid: true}}
+	db := models.ValueDecibel{FloatValue: models.FloatValue{Float: 12.5, Valid: true}}
+	dbm := models.ValuePower{FloatValue: models.FloatValue{Float: 14.2, Valid: true}}
+	count := models.IntValue{Int: 42, Valid: true}
+
+	return models.Status{
+		State:                                models.StateShowtime,
+		Mode:                                 models.Mode{Type: models.ModeTypeVDSL2},
+		Uptime:                               models.Duration{Duration: time.Hour},
+		DownstreamActualRate:                 rate,
+		UpstreamActualRate:                   rate,
+		DownstreamAttainableRate:             rate,
+		UpstreamAttainableRate:               rate,
+		DownstreamMinimumErrorFreeThroughput: rate,
+		UpstreamMinimumErrorFreeThroughput:   rate,
+		DownstreamBitswapEnabled:             on,
+		UpstreamBitswapEnabled:               on,
+		DownstreamSeamlessRateAdaption:       on,
+		UpstreamSeamlessRateAdaption:         on,
+		DownstreamInterleavingDelay:          delay,
+		UpstreamInterleavingDelay:            delay,
+		DownstreamImpulseNoiseProtection:     inp,
+		UpstreamImpulseNoiseProtection:       inp,
+		DownstreamRetransmissionEnabled:      on,
+		UpstreamRetransmissionEnabled:        on,
+		DownstreamAttenuation:                db,
+		UpstreamAttenuation:                  db,
+		DownstreamSNRMargin:                  db,
+		UpstreamSNRMargin:                    db,
+		DownstreamPower:                      dbm,
+		UpstreamPower:                        dbm,
+		DownstreamRTXTXCount:                 count,
+		UpstreamRTXTXCount:                   count,
+		DownstreamRTXCCount:                  count,
+		UpstreamRTXCCount:                    count,
+		DownstreamRTXUCCount:                 count,
+		UpstreamRTXUCCount:                   count,
+		DownstreamFECCount:                   count,
+		UpstreamFECCount:                     count,
+		DownstreamCRCCount:                   count,
+		UpstreamCRCCount:                     count,
+		DownstreamESCount:                    count,
+		UpstreamESCount:                      count,
+		DownstreamSESCount:                   count,
+		UpstreamSESCount:                     count,
+	}
+}
+
+func testStats() types.Stats {
+	return types.Stats{
+		Uptime:   24 * time.Hour,
+		Hostname: "modem",
+		Loads: types.Loads{
+			Load1:        "0.10",
+			Load5:        "0.20",
+			Load15:       "0.30",
+			RunningProcs: "1",
+			TotalProcs:   "80",
+		},
+		CPU: types.CPUInfo{User: 1, Nice: 2, System: 3, Idle: 90, IOWait: 1, IRQ: 1, SoftIRQ: 1, Steal: 0.5, Guest: 0.5},
+		MEM: types.MemInfo{Total: 1024, Free: 512, Buffers: 64, Cached: 128, SwapTotal: 0, SwapFree: 0},
+		FSInfos: []types.FSInfo{
+			{MountPoint: "/", Total: 100, Used: 60, Free: 40},
+		},
+		NetInterface: map[string]types.NetInterface{
+			"eth0": {
+				NetIPAddr:  types.NetIPAddr{IPv4: "192.168.1.1", IPv6: "fe80::1"},
+				NetDevInfo: types.NetDevInfo{Rx: 1000, Tx: 2000},
+			},
+		},
+	}
+}
+
+func TestCollectEmitsEveryMetric(t *testing.T) {
+	e := newTestExporter(config.Config{LegacyMetrics: true})
+
+	now := time.Now()
+	snap := snapshot{
+		status:      testStatus(),
+		dslUpdated:  now,
+		stats:       testStats(),
+		rtopUpdated: now,
+	}
+
+	metrics := collect(func(metrics chan<- prometheus.Metric) {
+		dslStatusCollector{e}.Collect(snap, metrics)
+		for name := range rtopCollectors {
+			rtopCollector{e, name}.Collect(snap, metrics)
+		}
+	})
+
+	emitted := make(map[*prometheus.Desc]bool, len(metrics))
+	for _, m := range metrics {
+		emitted[m.Desc()] = true
+	}
+
+	for i, m := range dslMetrics {
+		if !emitted[e.dslDescs[i]] {
+			t.Errorf("metric %s of dslMetrics was not emitted", m.name)
+		}
+		if m.legacy != "" && !emitted[e.legacyDescs[i]] {
+			t.Errorf("legacy metric %s of dslMetrics was not emitted", m.legacy)
+		}
+	}
+	for i, m := range rtopMetrics {
+		if !emitted[e.rtopDescs[i]] {
+			t.Errorf("metric %s of rtopMetrics was not emitted", m.name)
+		}
+	}
+}
+
+func TestCollectConvertsToBaseUnits(t *testing.T) {
+	e := newTestExporter(config.Config{})
+
+	want := map[string]float64{
+		"actual_rate_downstream_bits_per_second": 100000 * 1000,
+		"interleaving_delay_upstream_seconds":    0.008,
+		"snr_margin_downstream_decibels":         12.5,
+		"bitswap_enabled_upstream":               1,
+	}
+
+	metrics := collect(func(metrics chan<- prometheus.Metric) {
+		e.collectDslMetrics(testStatus(), metrics)
+	})
+
+	got := make(map[string]float64, len(metrics))
+	for _, m := range metrics {
+		got[e.descs.info(m.Desc()).name], _ = sampleOf(t, m)
+	}
+
+	for name, v := range want {
+		value, ok := got["xdsl_dsl_"+name]
+		if !ok {
+			t.Errorf("xdsl_dsl_%s was not emitted", name)
+		} else if value != v {
+			t.Errorf("xdsl_dsl_%s = %v, want %v", name, value, v)
+		}
+	}
+}
+
+func TestCollectSkipsInvalidValues(t *testing.T) {
+	e := newTestExporter(config.Config{})
+
+	metrics := collect(func(metrics chan<- prometheus.Metric) {
+		e.collectDslMetrics(models.Status{}, metrics)
+	})
+
+	if len(metrics) != 0 {
+		t.Errorf("collectDslMetrics() emitted %d metrics for an empty status, want 0", len(metrics))
+	}
+}
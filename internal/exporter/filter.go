@@ -0,0 +1,92 @@
+package exporter
+
+import (
+	"sync"
+
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// filter drops the samples whose metric name or label values are excluded by
+// the config.
+type filter struct {
+	metrics config.Matcher
+	labels  map[string]config.Matcher
+
+	// kept caches whether each metric name is kept.
+	kept sync.Map
+}
+
+// newFilter returns the filter of the config, or nil if it keeps every
+// sample. The patterns have been checked by config.Check already.
+func newFilter(cfg config.Filter) *filter {
+	if cfg.IsZero() {
+		return nil
+	}
+
+	f := &filter{labels: make(map[string]config.Matcher, len(cfg.Labels))}
+	f.metrics, _ = cfg.Metrics.Compile()
+	for name, p := range cfg.Labels {
+		f.labels[name], _ = p.Compile()
+	}
+	return f
+}
+
+// keep reports whether the sample of the Desc with the given label values is
+// exposed. A nil filter keeps every sample.
+func (f *filter) keep(info descInfo, labelValues []string) bool {
+	if f == nil {
+		return true
+	}
+
+	if !f.keepMetric(info.name) {
+		return false
+	}
+	for i, name := range info.labels {
+		m, ok := f.labels[name]
+		if ok && i < len(labelValues) && !m.Match(labelValues[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *filter) keepMetric(name string) bool {
+	if kept, ok := f.kept.Load(name); ok {
+		return kept.(bool)
+	}
+
+	kept := f.metrics.Match(name)
+	f.kept.Store(name, kept)
+	return kept
+}
+
+// collectors drops the collectors whose metrics are all excluded, so that
+// their data is not polled from the modem at all. Collectors that describe no
+// metrics in advance are kept.
+func (f *filter) collectors(collectors []namedCollector, table *descTable) []namedCollector {
+	if f == nil {
+		return collectors
+	}
+
+	var kept []namedCollector
+	for _, c := range collectors {
+		descs := make(chan *prometheus.Desc)
+		go func() {
+			c.Describe(descs)
+			close(descs)
+		}()
+
+		described, used := false, false
+		for desc := range descs {
+			described = true
+			if f.keepMetric(table.info(desc).name) {
+				used = true
+			}
+		}
+		if !described || used {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
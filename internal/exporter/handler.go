@@ -0,0 +1,107 @@
+package exporter
+
+import (
+	"context"
+	stdlog "log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+// scrapeCollector binds an Exporter to the context and the collectors of a
+// single scrape.
+type scrapeCollector struct {
+	ctx        context.Context
+	exporter   *Exporter
+	collectors []namedCollector
+}
+
+func (c scrapeCollector) Describe(descs chan<- *prometheus.Desc) {
+	c.exporter.Describe(descs)
+}
+
+func (c scrapeCollector) Collect(metrics chan<- prometheus.Metric) {
+	c.exporter.collect(c.ctx, c.collectors, metrics)
+}
+
+// cachedCollector serves the latest snapshot of an Exporter without polling.
+// The sources in pending are reported as failed.
+type cachedCollector struct {
+	exporter   *Exporter
+	collectors []namedCollector
+	pending    map[string]pollStatus
+}
+
+func (c cachedCollector) Describe(descs chan<- *prometheus.Desc) {
+	c.exporter.Describe(descs)
+}
+
+func (c cachedCollector) Collect(metrics chan<- prometheus.Metric) {
+	c.exporter.collectCached(c.collectors, c.pending, metrics)
+}
+
+// NewHandler returns a handler serving the default registry together with
+// the metrics of every given exporter. Each scrape is bounded by the timeout
+// announced by Prometheus, minus the given offset to leave room for the
+// response. The collect[] query parameter restricts a scrape to the named
+// collectors; exporters that poll in the background then only serve the
+// snapshot of those collectors.
+func NewHandler(exporters []*Exporter, timeoutOffset time.Duration, logger log.Logger) http.Handler {
+	errorLog := stdlog.New(log.NewStdlibAdapter(level.Error(logger)), "", 0)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		names, err := parseCollectors(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		selected := make([][]namedCollector, len(exporters))
+		for i, e := range exporters {
+			if selected[i], err = e.selectCollectors(names); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx, cancel := scrapeContext(r, timeoutOffset)
+		defer cancel()
+
+		registry := prometheus.NewRegistry()
+		for i, e := range exporters {
+			if err := registry.Register(scrapeCollector{ctx: ctx, exporter: e, collectors: selected[i]}); err != nil {
+				level.Error(logger).Log("msg", "could not register exporter", "err", err.Error()) //nolint:errcheck
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+		promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{ErrorLog: errorLog}).ServeHTTP(w, r)
+	})
+
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handler)
+}
+
+// scrapeContext derives the context of a scrape from its request. The request
+// is not bounded if Prometheus did not announce a timeout.
+func scrapeContext(r *http.Request, offset time.Duration) (context.Context, context.CancelFunc) {
+	seconds, err := strconv.ParseFloat(r.Header.Get(scrapeTimeoutHeader), 64)
+	if err != nil || seconds <= 0 {
+		return context.WithCancel(r.Context())
+	}
+
+	timeout := time.Duration(seconds*float64(time.Second)) - offset
+	if timeout <= 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	return context.WithTimeout(r.Context(), timeout)
+}
@@ -0,0 +1,198 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"3e8.eu/go/dsl/models"
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+)
+
+// fakeDsl is a DSL source whose polls hang while block is open.
+type fakeDsl struct {
+	block   chan struct{}
+	started chan struct{}
+	closed  chan struct{}
+	updates atomic.Int32
+	once    sync.Once
+}
+
+func newFakeDsl() *fakeDsl {
+	return &fakeDsl{
+		started: make(chan struct{}, 16),
+		closed:  make(chan struct{}),
+	}
+}
+
+func (f *fakeDsl) UpdateData(ctx context.Context) error {
+	f.updates.Add(1)
+	f.started <- struct{}{}
+	if f.block == nil {
+		return nil
+	}
+	select {
+	case <-f.block:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *fakeDsl) Status() models.Status                        { return testStatus() }
+func (f *fakeDsl) Bins() models.Bins                            { return models.Bins{} }
+func (f *fakeDsl) RawData() []byte                              { return nil }
+func (f *fakeDsl) ReconnectStats() (attempts, successes uint64) { return 0, 0 }
+func (f *fakeDsl) Close()                                       { f.once.Do(func() { close(f.closed) }) }
+
+// newFakeExporter returns an exporter polling the DSL status on scrape from a
+// fake source.
+func newFakeExporter(cfg config.Config) (*Exporter, *fakeDsl) {
+	source := newFakeDsl()
+	e := New(cfg, nil, nil, log.NewNopLogger())
+	e.dsl = source
+	return e, source
+}
+
+const actualRateMetric = "xdsl_dsl_actual_rate_downstream_bits_per_second"
+
+// scrape serves a request with the given scrape timeout and returns the
+// metric families of the response.
+func scrape(t *testing.T, handler http.Handler, timeout string) map[string]*dto.MetricFamily {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.Header.Set(scrapeTimeoutHeader, timeout)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+	}
+
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(w.Body)
+	if err != nil {
+		t.Fatalf("TextToMetricFamilies() = %v", err)
+	}
+	return families
+}
+
+// collectorUp returns the value of collector_up of the collector, or -1 if it
+// was not emitted.
+func collectorUp(families map[string]*dto.MetricFamily, collector string) float64 {
+	for _, m := range families["xdsl_scrape_collector_up"].GetMetric() {
+		for _, pair := range m.GetLabel() {
+			if pair.GetName() == "collector" && pair.GetValue() == collector {
+				return m.GetGauge().GetValue()
+			}
+		}
+	}
+	return -1
+}
+
+func TestHandlerDropsTimedOutSource(t *testing.T) {
+	e, source := newFakeExporter(config.Config{})
+	handler := NewHandler([]*Exporter{e}, 0, log.NewNopLogger())
+
+	families := scrape(t, handler, "1")
+	if _, ok := families[actualRateMetric]; !ok {
+		t.Fatalf("%s was not emitted by a scrape that finished in time", actualRateMetric)
+	}
+	if up := collectorUp(families, SubsystemDsl); up != 1 {
+		t.Fatalf("collector_up{collector=%q} = %v, want 1", SubsystemDsl, up)
+	}
+
+	source.block = make(chan struct{})
+	defer close(source.block)
+
+	start := time.Now()
+	families = scrape(t, handler, "0.05")
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("scrape took %s, want it bounded by the scrape timeout", elapsed)
+	}
+	if _, ok := families[actualRateMetric]; ok {
+		t.Errorf("%s was emitted although the source timed out", actualRateMetric)
+	}
+	if up := collectorUp(families, SubsystemDsl); up != 0 {
+		t.Errorf("collector_up{collector=%q} = %v, want 0", SubsystemDsl, up)
+	}
+}
+
+func TestRefreshReportsPendingSource(t *testing.T) {
+	e, source := newFakeExporter(config.Config{})
+
+	if pending := e.refresh(context.Background(), e.plan); len(pending) != 0 {
+		t.Fatalf("refresh() = %v, want no pending sources", pending)
+	}
+	<-source.started
+
+	source.block = make(chan struct{})
+	defer close(source.block)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-source.started
+		cancel()
+	}()
+
+	pending := e.refresh(ctx, e.plan)
+	if status, ok := pending[SubsystemDsl]; !ok || status.up {
+		t.Fatalf("refresh() = %v, want %s pending and down", pending, SubsystemDsl)
+	}
+
+	metrics := collect(func(metrics chan<- prometheus.Metric) {
+		e.collectSnapshot(e.collectors, pending, metrics)
+	})
+	for _, m := range metrics {
+		name := e.descs.info(m.Desc()).name
+		if name == actualRateMetric {
+			t.Errorf("%s was emitted although the source is still being polled", name)
+		}
+		if m.Desc() == e.collectorUp {
+			if value, _ := sampleOf(t, m); value != 0 {
+				t.Errorf("collector_up = %v, want 0", value)
+			}
+		}
+	}
+}
+
+func TestRefreshSharesPoll(t *testing.T) {
+	e, source := newFakeExporter(config.Config{})
+	source.block = make(chan struct{})
+
+	const scrapes = 3
+
+	var wg sync.WaitGroup
+	for i := 0; i < scrapes; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.refresh(context.Background(), e.plan)
+		}()
+	}
+
+	// Give the other scrapes time to join the poll in flight.
+	<-source.started
+	time.Sleep(50 * time.Millisecond)
+	close(source.block)
+	wg.Wait()
+
+	if updates := source.updates.Load(); updates != 1 {
+		t.Errorf("UpdateData() called %d times, want 1", updates)
+	}
+
+	metrics := collect(e.coalescedScrapes.Collect)
+	if value, _ := sampleOf(t, metrics[0]); value != scrapes-1 {
+		t.Errorf("coalesced scrapes = %v, want %d", value, scrapes-1)
+	}
+}
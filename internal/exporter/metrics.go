@@ -0,0 +1,242 @@
+package exporter
+
+import (
+	"3e8.eu/go/dsl/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rapidloop/rtop/pkg/types"
+)
+
+// dslMetric declares a metric read from a field of the go-dsl status.
+type dslMetric struct {
+	name      string
+	help      string
+	valueType prometheus.ValueType
+	// legacy is the name of the deprecated metric with a unit label that the
+	// metric replaces, if any.
+	legacy string
+	// value returns the value of the field, its unit as reported by go-dsl,
+	// which is converted to the base unit unless empty, and whether go-dsl
+	// could determine it.
+	value func(models.Status) (float64, string, bool)
+}
+
+// dslMetrics are the metrics read from plain fields of the go-dsl status. The
+// state sets, inventory and uptime need more than a single value and are
+// collected separately.
+var dslMetrics = []dslMetric{
+	{"actual_rate_downstream_bits_per_second", "Actual rate of downstream.", prometheus.GaugeValue, "actual_rate_downstream", func(s models.Status) (float64, string, bool) { return bandwidth(s.DownstreamActualRate) }},
+	{"actual_rate_upstream_bits_per_second", "Actual rate of upstream.", prometheus.GaugeValue, "actual_rate_upstream", func(s models.Status) (float64, string, bool) { return bandwidth(s.UpstreamActualRate) }},
+	{"attainable_rate_downstream_bits_per_second", "Attainable rate of downstream.", prometheus.GaugeValue, "attainable_rate_downstream", func(s models.Status) (float64, string, bool) { return bandwidth(s.DownstreamAttainableRate) }},
+	{"attainable_rate_upstream_bits_per_second", "Attainable rate of upstream.", prometheus.GaugeValue, "attainable_rate_upstream", func(s models.Status) (float64, string, bool) { return bandwidth(s.UpstreamAttainableRate) }},
+	{"minimum_error_free_throughput_downstream_bits_per_second", "Minimum error free throughput of downstream.", prometheus.GaugeValue, "minimum_error_free_throughput_downstream", func(s models.Status) (float64, string, bool) {
+		return bandwidth(s.DownstreamMinimumErrorFreeThroughput)
+	}},
+	{"minimum_error_free_throughput_upstream_bits_per_second", "Minimum error free throughput of upstream.", prometheus.GaugeValue, "minimum_error_free_throughput_upstream", func(s models.Status) (float64, string, bool) { return bandwidth(s.UpstreamMinimumErrorFreeThroughput) }},
+	{"bitswap_enabled_downstream", "Bitswap enabled of downstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return boolValue(s.DownstreamBitswapEnabled) }},
+	{"bitswap_enabled_upstream", "Bitswap enabled of upstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return boolValue(s.UpstreamBitswapEnabled) }},
+	{"seamless_rate_adaption_downstream", "Seamless rate adaption of downstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return boolValue(s.DownstreamSeamlessRateAdaption) }},
+	{"seamless_rate_adaption_upstream", "Seamless rate adaption of upstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return boolValue(s.UpstreamSeamlessRateAdaption) }},
+	{"interleaving_delay_downstream_seconds", "Interleaving delay of downstream.", prometheus.GaugeValue, "interleaving_delay_downstream", func(s models.Status) (float64, string, bool) { return milliseconds(s.DownstreamInterleavingDelay) }},
+	{"interleaving_delay_upstream_seconds", "Interleaving delay of upstream.", prometheus.GaugeValue, "interleaving_delay_upstream", func(s models.Status) (float64, string, bool) { return milliseconds(s.UpstreamInterleavingDelay) }},
+	{"impulse_noise_protection_downstream_symbols", "Impulse noise protection of downstream.", prometheus.GaugeValue, "impulse_noise_protection_downstream", func(s models.Status) (float64, string, bool) { return symbols(s.DownstreamImpulseNoiseProtection) }},
+	{"impulse_noise_protection_upstream_symbols", "Impulse noise protection of upstream.", prometheus.GaugeValue, "impulse_noise_protection_upstream", func(s models.Status) (float64, string, bool) { return symbols(s.UpstreamImpulseNoiseProtection) }},
+	{"retransmission_enabled_downstream", "Retransmission enabled of downstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return boolValue(s.DownstreamRetransmissionEnabled) }},
+	{"retransmission_enabled_upstream", "Retransmission enabled of upstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return boolValue(s.UpstreamRetransmissionEnabled) }},
+	{"attenuation_downstream_decibels", "Attenuation of downstream.", prometheus.GaugeValue, "attenuation_downstream", func(s models.Status) (float64, string, bool) { return decibel(s.DownstreamAttenuation) }},
+	{"attenuation_upstream_decibels", "Attenuation of upstream.", prometheus.GaugeValue, "attenuation_upstream", func(s models.Status) (float64, string, bool) { return decibel(s.UpstreamAttenuation) }},
+	{"snr_margin_downstream_decibels", "SNR margin of downstream.", prometheus.GaugeValue, "snr_margin_downstream", func(s models.Status) (float64, string, bool) { return decibel(s.DownstreamSNRMargin) }},
+	{"snr_margin_upstream_decibels", "SNR margin of upstream.", prometheus.GaugeValue, "snr_margin_upstream", func(s models.Status) (float64, string, bool) { return decibel(s.UpstreamSNRMargin) }},
+	{"power_downstream_dbm", "Power of downstream.", prometheus.GaugeValue, "power_downstream", func(s models.Status) (float64, string, bool) { return power(s.DownstreamPower) }},
+	{"power_upstream_dbm", "Power of upstream.", prometheus.GaugeValue, "power_upstream", func(s models.Status) (float64, string, bool) { return power(s.UpstreamPower) }},
+	{"rtxtx_count_downstream", "RTTX TX count of downstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.DownstreamRTXTXCount) }},
+	{"rtxtx_count_upstream", "RTTX TX count of upstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.UpstreamRTXTXCount) }},
+	{"rtxcc_count_downstream", "RTXCC count of downstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.DownstreamRTXCCount) }},
+	{"rtxcc_count_upstream", "RTXCC count of upstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.UpstreamRTXCCount) }},
+	{"rtxucc_count_downstream", "RTXUCC count of downstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.DownstreamRTXUCCount) }},
+	{"rtxucc_count_upstream", "RTXUCC count of upstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.UpstreamRTXUCCount) }},
+	{"fec_count_downstream", "FEC count of downstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.DownstreamFECCount) }},
+	{"fec_count_upstream", "FEC count of upstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.UpstreamFECCount) }},
+	{"crc_count_downstream", "CRC count of downstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.DownstreamCRCCount) }},
+	{"crc_count_upstream", "CRC count of upstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.UpstreamCRCCount) }},
+	{"es_count_downstream", "ES count of downstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.DownstreamESCount) }},
+	{"es_count_upstream", "ES count of upstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.UpstreamESCount) }},
+	{"ses_count_downstream", "SES count of downstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.DownstreamSESCount) }},
+	{"ses_count_upstream", "SES count of upstream.", prometheus.GaugeValue, "", func(s models.Status) (float64, string, bool) { return intValue(s.UpstreamSESCount) }},
+}
+
+// sampleValue is a sample of a metric with its label values.
+type sampleValue struct {
+	value  float64
+	labels []string
+}
+
+// rtopMetric declares a metric read from the system stats of rtop.
+type rtopMetric struct {
+	name      string
+	collector string
+	help      string
+	valueType prometheus.ValueType
+	labels    []string
+	values    func(types.Stats) []sampleValue
+}
+
+var rtopMetrics = []rtopMetric{
+	{"info", "rtop_host", "Information about the host.", prometheus.GaugeValue, []string{"hostname"}, func(s types.Stats) []sampleValue { return single(1, s.Hostname) }},
+	{"uptime_seconds", "rtop_host", "Uptime of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return positive(s.Uptime.Seconds()) }},
+	{"load1", "rtop_host", "Load1 of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(stringToFloat64(s.Loads.Load1)) }},
+	{"load5", "rtop_host", "Load5 of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(stringToFloat64(s.Loads.Load5)) }},
+	{"load15", "rtop_host", "Load15 of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(stringToFloat64(s.Loads.Load15)) }},
+	{"load_running", "rtop_host", "LoadRunning of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(stringToFloat64(s.Loads.RunningProcs)) }},
+	{"load_total", "rtop_host", "LoadTotal of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(stringToFloat64(s.Loads.TotalProcs)) }},
+	{"cpu_user", "rtop_cpu", "CPU user of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.CPU.User)) }},
+	{"cpu_system", "rtop_cpu", "CPU system of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.CPU.System)) }},
+	{"cpu_nice", "rtop_cpu", "CPU nice of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.CPU.Nice)) }},
+	{"cpu_idle", "rtop_cpu", "CPU idle of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.CPU.Idle)) }},
+	{"cpu_iowait", "rtop_cpu", "CPU iowait of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.CPU.IOWait)) }},
+	{"cpu_irq", "rtop_cpu", "CPU irq of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.CPU.IRQ)) }},
+	{"cpu_softirq", "rtop_cpu", "CPU softirq of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.CPU.SoftIRQ)) }},
+	{"cpu_steal", "rtop_cpu", "CPU steal of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.CPU.Steal)) }},
+	{"cpu_guest", "rtop_cpu", "CPU guest of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.CPU.Guest)) }},
+	{"mem_total", "rtop_mem", "Total memory of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.MEM.Total)) }},
+	{"mem_free", "rtop_mem", "Free memory of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.MEM.Free)) }},
+	{"mem_used", "rtop_mem", "Used memory of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.MEM.Used())) }},
+	{"mem_buffers", "rtop_mem", "Buffers memory of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.MEM.Buffers)) }},
+	{"mem_cached", "rtop_mem", "Cached memory of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.MEM.Cached)) }},
+	{"mem_swap_free", "rtop_mem", "Free swap memory of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.MEM.SwapFree)) }},
+	{"mem_swap_total", "rtop_mem", "Total swap memory of the host.", prometheus.GaugeValue, nil, func(s types.Stats) []sampleValue { return single(float64(s.MEM.SwapTotal)) }},
+	{"fs_total", "rtop_fs", "Total filesystems of the host.", prometheus.GaugeValue, []string{"mount"}, func(s types.Stats) []sampleValue {
+		return fsValues(s, func(fs types.FSInfo) uint64 { return fs.Total })
+	}},
+	{"fs_used", "rtop_fs", "Used filesystem of the host.", prometheus.GaugeValue, []string{"mount"}, func(s types.Stats) []sampleValue { return fsValues(s, func(fs types.FSInfo) uint64 { return fs.Used }) }},
+	{"fs_free", "rtop_fs", "Free filesystem of the host.", prometheus.GaugeValue, []string{"mount"}, func(s types.Stats) []sampleValue { return fsValues(s, func(fs types.FSInfo) uint64 { return fs.Free }) }},
+	{"net_rx", "rtop_net", "Total received bytes of the network.", prometheus.GaugeValue, []string{"interface", "ipv4", "ipv6"}, func(s types.Stats) []sampleValue {
+		return netValues(s, func(n types.NetInterface) uint64 { return n.Rx })
+	}},
+	{"net_tx", "rtop_net", "Total transmitted bytes of the network.", prometheus.GaugeValue, []string{"interface", "ipv4", "ipv6"}, func(s types.Stats) []sampleValue {
+		return netValues(s, func(n types.NetInterface) uint64 { return n.Tx })
+	}},
+}
+
+func newDslDescs(table *descTable, namespace string, constLabels prometheus.Labels) []*prometheus.Desc {
+	descs := make([]*prometheus.Desc, len(dslMetrics))
+	for i, m := range dslMetrics {
+		descs[i] = table.new(prometheus.BuildFQName(namespace, SubsystemDsl, m.name), m.help, nil, constLabels)
+	}
+	return descs
+}
+
+// newLegacyDescs returns the deprecated metrics with a unit label, indexed
+// like dslMetrics, with nil for the metrics that did not replace one.
+func newLegacyDescs(table *descTable, namespace string, constLabels prometheus.Labels) []*prometheus.Desc {
+	descs := make([]*prometheus.Desc, len(dslMetrics))
+	for i, m := range dslMetrics {
+		if m.legacy == "" {
+			continue
+		}
+		descs[i] = table.new(
+			prometheus.BuildFQName(namespace, SubsystemDsl, m.legacy),
+			m.help+" Deprecated: use the metric in base units instead.",
+			[]string{"unit"},
+			constLabels,
+		)
+	}
+	return descs
+}
+
+func newRtopDescs(table *descTable, namespace string, constLabels prometheus.Labels) []*prometheus.Desc {
+	descs := make([]*prometheus.Desc, len(rtopMetrics))
+	for i, m := range rtopMetrics {
+		descs[i] = table.new(prometheus.BuildFQName(namespace, SubsystemRtop, m.name), m.help, m.labels, constLabels)
+	}
+	return descs
+}
+
+func (e *Exporter) collectDslMetrics(status models.Status, metrics chan<- prometheus.Metric) {
+	for i, m := range dslMetrics {
+		value, unit, ok := m.value(status)
+		if !ok {
+			continue
+		}
+		if unit == "" {
+			e.sample(metrics, e.dslDescs[i], m.valueType, value)
+			continue
+		}
+
+		e.sample(metrics, e.dslDescs[i], m.valueType, toBaseUnit(value, unit))
+		if len(e.legacyDescs) == 0 {
+			continue
+		}
+		if legacy := e.legacyDescs[i]; legacy != nil {
+			e.sample(metrics, legacy, m.valueType, value, unit)
+		}
+	}
+}
+
+// collectRtop emits the metrics of rtopMetrics that belong to the collector.
+func (e *Exporter) collectRtop(collector string, stats types.Stats, metrics chan<- prometheus.Metric) {
+	for i, m := range rtopMetrics {
+		if m.collector != collector {
+			continue
+		}
+		for _, v := range m.values(stats) {
+			e.sample(metrics, e.rtopDescs[i], m.valueType, v.value, v.labels...)
+		}
+	}
+}
+
+func intValue(v models.IntValue) (float64, string, bool) {
+	return float64(v.Int), "", v.Valid
+}
+
+func boolValue(v models.BoolValue) (float64, string, bool) {
+	return boolToFloat64(v.Bool), "", v.Valid
+}
+
+func bandwidth(v models.ValueBandwidth) (float64, string, bool) {
+	return float64(v.Int), v.Unit(), v.Valid
+}
+
+func milliseconds(v models.ValueMilliseconds) (float64, string, bool) {
+	return v.Float, v.Unit(), v.Valid
+}
+
+func symbols(v models.ValueSymbols) (float64, string, bool) {
+	return v.Float, v.Unit(), v.Valid
+}
+
+func decibel(v models.ValueDecibel) (float64, string, bool) {
+	return v.Float, v.Unit(), v.Valid
+}
+
+func power(v models.ValuePower) (float64, string, bool) {
+	return v.Float, v.Unit(), v.Valid
+}
+
+func single(value float64, labels ...string) []sampleValue {
+	return []sampleValue{{value: value, labels: labels}}
+}
+
+// positive returns the value as a single sample, or none if it is not
+// positive, i.e. unknown.
+func positive(value float64) []sampleValue {
+	if value <= 0 {
+		return nil
+	}
+	return single(value)
+}
+
+func fsValues(stats types.Stats, value func(types.FSInfo) uint64) []sampleValue {
+	values := make([]sampleValue, 0, len(stats.FSInfos))
+	for _, fs := range stats.FSInfos {
+		values = append(values, sampleValue{value: float64(value(fs)), labels: []string{fs.MountPoint}})
+	}
+	return values
+}
+
+func netValues(stats types.Stats, value func(types.NetInterface) uint64) []sampleValue {
+	values := make([]sampleValue, 0, len(stats.NetInterface))
+	for name, intf := range stats.NetInterface {
+		values = append(values, sampleValue{value: float64(value(intf)), labels: []string{name, intf.IPv4, intf.IPv6}})
+	}
+	return values
+}
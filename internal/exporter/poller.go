@@ -0,0 +1,128 @@
+package exporter
+
+import (
+	"context"
+	"time"
+
+	"3e8.eu/go/dsl/models"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rapidloop/rtop/pkg/types"
+)
+
+// snapshot holds the latest data polled from the modem. A zero update time
+// means the source has not been polled successfully yet.
+type snapshot struct {
+	status      models.Status
+	bins        models.Bins
+	rawData     []byte
+	errorTotals map[counterKey]float64
+	lineEvents  lineEvents
+	dslUpdated  time.Time
+	stats       types.Stats
+	rtopUpdated time.Time
+
+	commandOutputs map[string][]byte
+	commandUpdated time.Time
+
+	// polls holds the outcome of the last poll of each collector.
+	polls map[string]pollStatus
+}
+
+// updated returns the time the source was last polled successfully.
+func (s snapshot) updated(source string) time.Time {
+	switch source {
+	case SubsystemDsl:
+		return s.dslUpdated
+	case SubsystemRtop:
+		return s.rtopUpdated
+	case SubsystemCommand:
+		return s.commandUpdated
+	}
+	return time.Time{}
+}
+
+// Poll refreshes the snapshot every poll interval until ctx is done, so that
+// scrapes are served from memory and never log in to the modem themselves.
+// It returns immediately if the exporter is configured to poll on scrape.
+func (e *Exporter) Poll(ctx context.Context) {
+	if e.pollInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(e.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		level.Debug(e.logger).Log("msg", "polling modem...") //nolint:errcheck
+		e.getDataFromClients(ctx, e.plan, 0)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// collectSnapshot emits the snapshot of the given collectors. The status of
+// the sources in pending replaces that of their last poll, so their series are
+// dropped when polling on scrape.
+func (e *Exporter) collectSnapshot(collectors []namedCollector, pending map[string]pollStatus, metrics chan<- prometheus.Metric) {
+	e.mu.RLock()
+	snap := e.snapshot
+	snap.polls = make(map[string]pollStatus, len(e.snapshot.polls))
+	for collector, status := range e.snapshot.polls {
+		snap.polls[collector] = status
+	}
+	e.mu.RUnlock()
+
+	for collector, status := range pending {
+		snap.polls[collector] = status
+	}
+
+	now := time.Now()
+
+	for _, c := range collectors {
+		if e.isFresh(snap.updated(c.source), snap.polls[c.source], now) {
+			c.Collect(snap, metrics)
+		}
+	}
+
+	e.collectSnapshotAge(SubsystemDsl, snap.dslUpdated, now, metrics)
+	e.collectSnapshotAge(SubsystemRtop, snap.rtopUpdated, now, metrics)
+	e.collectSnapshotAge(SubsystemCommand, snap.commandUpdated, now, metrics)
+	plan := planFor(collectors)
+	if e.pollsDsl(plan) {
+		e.collectPollStatus(SubsystemDsl, snap.polls[SubsystemDsl], snap.dslUpdated, metrics)
+	}
+	if e.pollsRtop(plan) {
+		e.collectPollStatus(SubsystemRtop, snap.polls[SubsystemRtop], snap.rtopUpdated, metrics)
+	}
+	if e.pollsCommands(plan) {
+		e.collectPollStatus(SubsystemCommand, snap.polls[SubsystemCommand], snap.commandUpdated, metrics)
+	}
+	e.collectReconnectStats(metrics)
+}
+
+func (e *Exporter) collectSnapshotAge(collector string, updated, now time.Time, metrics chan<- prometheus.Metric) {
+	if updated.IsZero() {
+		return
+	}
+	metrics <- prometheus.MustNewConstMetric(e.snapshotAge, prometheus.GaugeValue, now.Sub(updated).Seconds(), collector)
+}
+
+// isFresh reports whether data updated at the given time may still be served.
+// When polling on scrape, only data of the last poll of its source is served,
+// so a failed poll drops the series instead of repeating the previous values.
+// In the background, series are dropped once the data is older than the
+// configured max staleness.
+func (e *Exporter) isFresh(updated time.Time, last pollStatus, now time.Time) bool {
+	if updated.IsZero() {
+		return false
+	}
+	if e.pollInterval <= 0 {
+		return !updated.Before(last.started)
+	}
+	return e.maxStaleness <= 0 || now.Sub(updated) <= e.maxStaleness
+}
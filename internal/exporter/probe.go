@@ -0,0 +1,201 @@
+package exporter
+
+import (
+	stdlog "log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+	"github.com/Dentrax/xdsl-exporter/internal/dsl"
+	"github.com/Dentrax/xdsl-exporter/internal/rtop"
+)
+
+// ProbeHandler serves the multi-target probe endpoint in the style of the
+// blackbox_exporter: /probe?target=<host>&module=<module>. It keeps one
+// Exporter per target and module, so the modem session is reused across
+// probes. Targets that are no longer probed are closed after the idle
+// timeout, and the least recently probed target is closed when a new one
+// would exceed the maximum number of targets.
+type ProbeHandler struct {
+	cfg      config.Config
+	logger   log.Logger
+	errorLog *stdlog.Logger
+
+	mu        sync.Mutex
+	exporters map[string]*probeTarget
+}
+
+// probeTarget is the Exporter of a probed target and module.
+type probeTarget struct {
+	exporter *Exporter
+	lastUsed time.Time
+}
+
+func NewProbeHandler(cfg config.Config, logger log.Logger) *ProbeHandler {
+	return &ProbeHandler{
+		cfg:       cfg,
+		logger:    logger,
+		errorLog:  stdlog.New(log.NewStdlibAdapter(level.Error(logger)), "", 0),
+		exporters: make(map[string]*probeTarget),
+	}
+}
+
+func (h *ProbeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	target := params.Get("target")
+	module := params.Get("module")
+
+	cfg, err := h.cfg.ProbeConfig(target, module)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	names, err := parseCollectors(params)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	e, err := h.exporter(cfg, target, module)
+	if err != nil {
+		level.Error(h.logger).Log("msg", "could not create exporter", "target", target, "module", module, "err", err.Error()) //nolint:errcheck
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	collectors, err := e.selectCollectors(names)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := scrapeContext(r, h.cfg.ScrapeTimeoutOffset)
+	defer cancel()
+
+	start := time.Now()
+	pending := e.refresh(ctx, planFor(collectors))
+	duration := time.Since(start)
+
+	probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "Whether the DSL status of the target could be polled.",
+	})
+	probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "Duration of the probe in seconds.",
+	})
+	probeSuccess.Set(boolToFloat64(e.probeSuccess(pending)))
+	probeDuration.Set(duration.Seconds())
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(probeSuccess, probeDuration)
+	if err := registry.Register(cachedCollector{exporter: e, collectors: collectors, pending: pending}); err != nil {
+		level.Error(h.logger).Log("msg", "could not register exporter", "target", target, "module", module, "err", err.Error()) //nolint:errcheck
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{ErrorLog: h.errorLog}).ServeHTTP(w, r)
+}
+
+// Close closes the clients of every probed target.
+func (h *ProbeHandler) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for key, t := range h.exporters {
+		t.exporter.CloseClient()
+		delete(h.exporters, key)
+	}
+}
+
+// exporter returns the Exporter of the target, creating it on first use.
+// Probes are always polled on request, regardless of the poll interval.
+func (h *ProbeHandler) exporter(cfg config.Config, target, module string) (*Exporter, error) {
+	key := module + "/" + target
+	now := time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.evict(now)
+
+	if t, ok := h.exporters[key]; ok {
+		t.lastUsed = now
+		return t.exporter, nil
+	}
+
+	cfg.PollInterval = 0
+
+	dslClient, err := dsl.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.cfg.ProbeMaxTargets > 0 && len(h.exporters) >= h.cfg.ProbeMaxTargets {
+		h.evictOldest()
+	}
+
+	e := New(cfg, dslClient, rtop.New(cfg), log.With(h.logger, "target", target, "module", module))
+	h.exporters[key] = &probeTarget{exporter: e, lastUsed: now}
+
+	return e, nil
+}
+
+// evict closes the targets that were not probed within the idle timeout. It
+// must be called with h.mu held.
+func (h *ProbeHandler) evict(now time.Time) {
+	if h.cfg.ProbeIdleTimeout <= 0 {
+		return
+	}
+	for key, t := range h.exporters {
+		if now.Sub(t.lastUsed) > h.cfg.ProbeIdleTimeout {
+			h.close(key, t, "idle")
+		}
+	}
+}
+
+// evictOldest closes the least recently probed target. It must be called with
+// h.mu held.
+func (h *ProbeHandler) evictOldest() {
+	var (
+		oldestKey string
+		oldest    *probeTarget
+	)
+	for key, t := range h.exporters {
+		if oldest == nil || t.lastUsed.Before(oldest.lastUsed) {
+			oldestKey, oldest = key, t
+		}
+	}
+	if oldest != nil {
+		h.close(oldestKey, oldest, "too many targets")
+	}
+}
+
+// close removes the target and closes its clients in the background, so that
+// a session that hangs does not block the probes of other targets.
+func (h *ProbeHandler) close(key string, t *probeTarget, reason string) {
+	delete(h.exporters, key)
+	level.Debug(h.logger).Log("msg", "closing probed target", "target", key, "reason", reason) //nolint:errcheck
+	go t.exporter.CloseClient()
+}
+
+// probeSuccess reports whether the last poll of the DSL status succeeded and
+// finished within the probe, i.e. it is not pending.
+func (e *Exporter) probeSuccess(pending map[string]pollStatus) bool {
+	if status, ok := pending[SubsystemDsl]; ok {
+		return status.up
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.snapshot.polls[SubsystemDsl].up
+}
@@ -0,0 +1,100 @@
+package exporter
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+)
+
+// probeTargets returns a probe handler with a target per key, last probed the
+// given time before now, and their sources.
+func probeTargets(cfg config.Config, now time.Time, idle map[string]time.Duration) (*ProbeHandler, map[string]*fakeDsl) {
+	h := NewProbeHandler(cfg, log.NewNopLogger())
+	sources := make(map[string]*fakeDsl, len(idle))
+	for key, d := range idle {
+		e, source := newFakeExporter(cfg)
+		h.exporters[key] = &probeTarget{exporter: e, lastUsed: now.Add(-d)}
+		sources[key] = source
+	}
+	return h, sources
+}
+
+func probedKeys(h *ProbeHandler) []string {
+	var keys []string
+	for key := range h.exporters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// waitClosed fails the test unless the source is closed in time.
+func waitClosed(t *testing.T, key string, source *fakeDsl) {
+	t.Helper()
+	select {
+	case <-source.closed:
+	case <-time.After(time.Second):
+		t.Errorf("target %s was not closed", key)
+	}
+}
+
+func assertOpen(t *testing.T, key string, source *fakeDsl) {
+	t.Helper()
+	select {
+	case <-source.closed:
+		t.Errorf("target %s was closed", key)
+	default:
+	}
+}
+
+func TestProbeEvict(t *testing.T) {
+	now := time.Now()
+	h, sources := probeTargets(config.Config{ProbeIdleTimeout: time.Minute}, now, map[string]time.Duration{
+		"default/idle":   2 * time.Minute,
+		"default/active": 30 * time.Second,
+	})
+
+	h.evict(now)
+
+	if keys := probedKeys(h); len(keys) != 1 || keys[0] != "default/active" {
+		t.Errorf("targets after evict() = %v, want [default/active]", keys)
+	}
+	waitClosed(t, "default/idle", sources["default/idle"])
+	assertOpen(t, "default/active", sources["default/active"])
+}
+
+func TestProbeEvictDisabled(t *testing.T) {
+	now := time.Now()
+	h, sources := probeTargets(config.Config{}, now, map[string]time.Duration{
+		"default/idle": time.Hour,
+	})
+
+	h.evict(now)
+
+	if keys := probedKeys(h); len(keys) != 1 {
+		t.Errorf("targets after evict() = %v, want [default/idle]", keys)
+	}
+	assertOpen(t, "default/idle", sources["default/idle"])
+}
+
+func TestProbeEvictOldest(t *testing.T) {
+	now := time.Now()
+	h, sources := probeTargets(config.Config{ProbeMaxTargets: 3}, now, map[string]time.Duration{
+		"default/a": time.Second,
+		"default/b": 3 * time.Second,
+		"default/c": 2 * time.Second,
+	})
+
+	h.evictOldest()
+
+	if keys := probedKeys(h); len(keys) != 2 || keys[0] != "default/a" || keys[1] != "default/c" {
+		t.Errorf("targets after evictOldest() = %v, want [default/a default/c]", keys)
+	}
+	waitClosed(t, "default/b", sources["default/b"])
+	assertOpen(t, "default/a", sources["default/a"])
+	assertOpen(t, "default/c", sources["default/c"])
+}
@@ -0,0 +1,139 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"3e8.eu/go/dsl/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lineEvents counts the resyncs and trainings of the line seen across polls.
+type lineEvents struct {
+	resyncs    uint64
+	trainings  uint64
+	lastResync time.Time
+	// lastTraining is the time it took the last training to reach showtime,
+	// or zero if none has been seen yet.
+	lastTraining time.Duration
+}
+
+// lineEventMetric declares a metric of the resyncs and trainings of the line.
+type lineEventMetric struct {
+	name      string
+	help      string
+	valueType prometheus.ValueType
+	value     func(lineEvents) (float64, bool)
+}
+
+var lineEventMetrics = []lineEventMetric{
+	{"resyncs_total", "Total number of resyncs of the DSL line seen by the exporter.", prometheus.CounterValue, func(ev lineEvents) (float64, bool) { return float64(ev.resyncs), true }},
+	{"training_attempts_total", "Total number of trainings of the DSL line seen by the exporter.", prometheus.CounterValue, func(ev lineEvents) (float64, bool) { return float64(ev.trainings), true }},
+	{"last_resync_timestamp_seconds", "Unix timestamp at which the DSL line synchronized again after the last resync.", prometheus.GaugeValue, func(ev lineEvents) (float64, bool) {
+		return float64(ev.lastResync.Unix()), !ev.lastResync.IsZero()
+	}},
+	{"last_training_duration_seconds", "Time the last training of the DSL line took to reach showtime.", prometheus.GaugeValue, func(ev lineEvents) (float64, bool) {
+		return ev.lastTraining.Seconds(), ev.lastTraining > 0
+	}},
+}
+
+// lineTracker follows the state and uptime of the line across polls to detect
+// resyncs and trainings, which are otherwise only visible as a reset uptime.
+type lineTracker struct {
+	mu     sync.Mutex
+	events lineEvents
+
+	seen     bool
+	synced   bool
+	showtime bool
+	training bool
+	uptime   time.Duration
+	// trainingStarted is the time the current training was first seen.
+	trainingStarted time.Time
+}
+
+// observe records the status polled at the given time and returns the events
+// seen so far. A resync is counted when the line reaches showtime again after
+// having been in showtime before, or when its uptime went backwards in between
+// two polls. Polls with an unknown state are ignored. Trainings are counted
+// when the line enters one of the initialization states, and inferred from a
+// resync if it was missed.
+func (t *lineTracker) observe(status models.Status, now time.Time) lineEvents {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if status.State == models.StateUnknown {
+		return t.events
+	}
+
+	showtime := status.State == models.StateShowtime
+	training := isTraining(status.State)
+	uptime := status.Uptime.Duration
+
+	if training && !t.training {
+		t.events.trainings++
+		t.trainingStarted = now
+	}
+
+	if showtime {
+		synced := now
+		if uptime > 0 {
+			synced = now.Add(-uptime)
+		}
+
+		resynced := t.seen && ((t.synced && !t.showtime) || (t.showtime && uptime > 0 && uptime < t.uptime))
+		if resynced {
+			t.events.resyncs++
+			t.events.lastResync = synced
+			if t.trainingStarted.IsZero() {
+				t.events.trainings++
+			}
+		}
+
+		if !t.trainingStarted.IsZero() {
+			if d := synced.Sub(t.trainingStarted); d > 0 {
+				t.events.lastTraining = d
+			}
+			t.trainingStarted = time.Time{}
+		}
+
+		t.synced = true
+	}
+
+	t.seen = true
+	t.showtime = showtime
+	t.training = training
+	t.uptime = uptime
+
+	return t.events
+}
+
+func isTraining(state models.State) bool {
+	switch state {
+	case models.StateInit,
+		models.StateInitHandshake,
+		models.StateInitChannelDiscovery,
+		models.StateInitTraining,
+		models.StateInitChannelAnalysisExchange:
+		return true
+	}
+	return false
+}
+
+// newLineEventDescs returns the descs of the line event metrics, indexed like
+// lineEventMetrics.
+func newLineEventDescs(table *descTable, namespace string, constLabels prometheus.Labels) []*prometheus.Desc {
+	descs := make([]*prometheus.Desc, len(lineEventMetrics))
+	for i, m := range lineEventMetrics {
+		descs[i] = table.new(prometheus.BuildFQName(namespace, SubsystemDsl, m.name), m.help, nil, constLabels)
+	}
+	return descs
+}
+
+func (e *Exporter) collectLineEvents(events lineEvents, metrics chan<- prometheus.Metric) {
+	for i, m := range lineEventMetrics {
+		if value, ok := m.value(events); ok {
+			e.sample(metrics, e.lineEventDescs[i], m.valueType, value)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package exporter
+
+import (
+	"testing"
+	"time"
+
+	"3e8.eu/go/dsl/models"
+)
+
+func TestLineTrackerObserve(t *testing.T) {
+	start := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	type poll struct {
+		state  models.State
+		uptime time.Duration
+	}
+	showtime := func(uptime time.Duration) poll { return poll{models.StateShowtime, uptime} }
+
+	tests := []struct {
+		name  string
+		polls []poll
+		want  lineEvents
+	}{
+		{
+			name:  "first showtime is not a resync",
+			polls: []poll{showtime(time.Hour), showtime(time.Hour + time.Minute)},
+			want:  lineEvents{},
+		},
+		{
+			name:  "unknown states are ignored",
+			polls: []poll{showtime(time.Hour), {models.StateUnknown, 0}, showtime(time.Hour + 2*time.Minute)},
+			want:  lineEvents{},
+		},
+		{
+			name:  "uptime going backwards",
+			polls: []poll{showtime(time.Hour), showtime(30 * time.Second)},
+			want: lineEvents{
+				resyncs:    1,
+				trainings:  1,
+				lastResync: start.Add(time.Minute - 30*time.Second),
+			},
+		},
+		{
+			name: "training observed",
+			polls: []poll{
+				showtime(time.Hour),
+				{models.StateDown, 0},
+				{models.StateInitHandshake, 0},
+				{models.StateInitTraining, 0},
+				showtime(10 * time.Second),
+			},
+			want: lineEvents{
+				resyncs:      1,
+				trainings:    1,
+				lastResync:   start.Add(4*time.Minute - 10*time.Second),
+				lastTraining: 2*time.Minute - 10*time.Second,
+			},
+		},
+		{
+			name: "showtime after training without prior showtime",
+			polls: []poll{
+				{models.StateInitTraining, 0},
+				showtime(30 * time.Second),
+			},
+			want: lineEvents{
+				trainings:    1,
+				lastTraining: 30 * time.Second,
+			},
+		},
+		{
+			name: "two resyncs",
+			polls: []poll{
+				showtime(time.Hour),
+				{models.StateDown, 0},
+				showtime(time.Minute),
+				showtime(20 * time.Second),
+			},
+			want: lineEvents{
+				resyncs:    2,
+				trainings:  2,
+				lastResync: start.Add(3*time.Minute - 20*time.Second),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tracker lineTracker
+
+			var got lineEvents
+			for i, p := range tt.polls {
+				status := models.Status{State: p.state, Uptime: models.Duration{Duration: p.uptime}}
+				got = tracker.observe(status, start.Add(time.Duration(i)*time.Minute))
+			}
+
+			if got.resyncs != tt.want.resyncs {
+				t.Errorf("resyncs = %d, want %d", got.resyncs, tt.want.resyncs)
+			}
+			if got.trainings != tt.want.trainings {
+				t.Errorf("trainings = %d, want %d", got.trainings, tt.want.trainings)
+			}
+			if !got.lastResync.Equal(tt.want.lastResync) {
+				t.Errorf("lastResync = %v, want %v", got.lastResync, tt.want.lastResync)
+			}
+			if got.lastTraining != tt.want.lastTraining {
+				t.Errorf("lastTraining = %v, want %v", got.lastTraining, tt.want.lastTraining)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package exporter
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// regexRule is a compiled config.RegexRule.
+type regexRule struct {
+	desc      *prometheus.Desc
+	valueType prometheus.ValueType
+	re        *regexp.Regexp
+	value     string
+	// labels and templates hold the names of the labels and the templates
+	// of their values, sorted by name.
+	labels    []string
+	templates []string
+}
+
+// newRegexRules compiles the rules into metrics named by fqName. The rules
+// have been checked by config.Check already.
+func newRegexRules(table *descTable, rules []config.RegexRule, fqName func(name string) string, help string, constLabels prometheus.Labels) []regexRule {
+	compiled := make([]regexRule, 0, len(rules))
+	for _, rule := range rules {
+		r := regexRule{
+			valueType: prometheus.GaugeValue,
+			re:        regexp.MustCompile(rule.Regex),
+			value:     rule.Value,
+		}
+		if rule.Type == config.RuleTypeCounter {
+			r.valueType = prometheus.CounterValue
+		}
+		if r.value == "" {
+			r.value = "$1"
+		}
+
+		for name := range rule.Labels {
+			r.labels = append(r.labels, name)
+		}
+		sort.Strings(r.labels)
+		for _, name := range r.labels {
+			r.templates = append(r.templates, rule.Labels[name])
+		}
+
+		ruleHelp := rule.Help
+		if ruleHelp == "" {
+			ruleHelp = help
+		}
+		r.desc = table.new(fqName(rule.Name), ruleHelp, r.labels, constLabels)
+
+		compiled = append(compiled, r)
+	}
+	return compiled
+}
+
+// collectRegexRules emits a sample for every match of the rules in data.
+// Matches that repeat the label values of an earlier match of the same rule
+// are skipped, as a series cannot be exposed twice.
+func (e *Exporter) collectRegexRules(rules []regexRule, data []byte, metrics chan<- prometheus.Metric) {
+	for _, r := range rules {
+		seen := make(map[string]bool)
+		for _, match := range r.re.FindAllSubmatchIndex(data, -1) {
+			labelValues := make([]string, len(r.templates))
+			for i, template := range r.templates {
+				labelValues[i] = string(r.re.Expand(nil, []byte(template), data, match))
+			}
+
+			key := strings.Join(labelValues, "\xff")
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			value := string(r.re.Expand(nil, []byte(r.value), data, match))
+			e.sample(metrics, r.desc, r.valueType, stringToFloat64(strings.TrimSpace(value)), labelValues...)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package exporter
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+)
+
+func TestCollectRegexRules(t *testing.T) {
+	data := []byte(`Since Link time = 1 days 2 hours
+FEC:		1234		56
+CRC:		7		8
+Path:	0, Upstream rate = 40000 Kbps, Downstream rate = 100000 Kbps
+Path:	1, Upstream rate = 0 Kbps, Downstream rate = 0 Kbps
+Path:	0, Upstream rate = 1 Kbps, Downstream rate = 1 Kbps
+Status: Showtime
+`)
+
+	// sample is a sample of a rule, formatted for comparison.
+	type sample struct {
+		value  float64
+		labels string
+	}
+
+	tests := []struct {
+		name        string
+		rule        config.RegexRule
+		want        []sample
+		wantInvalid float64
+	}{
+		{
+			name: "default value",
+			rule: config.RegexRule{Name: "fec", Regex: `FEC:\s+(\d+)`},
+			want: []sample{{1234, ""}},
+		},
+		{
+			name: "value and labels from submatches",
+			rule: config.RegexRule{
+				Name:   "errors",
+				Regex:  `(?m)^(?P<kind>FEC|CRC):\s+(\d+)\s+(?P<up>\d+)`,
+				Value:  "${up}",
+				Labels: map[string]string{"kind": "${kind}", "direction": "upstream"},
+			},
+			want: []sample{{56, "direction=upstream,kind=FEC"}, {8, "direction=upstream,kind=CRC"}},
+		},
+		{
+			name: "repeated label values are skipped",
+			rule: config.RegexRule{
+				Name:   "path_rate",
+				Regex:  `Path:\s+(\d+), Upstream rate = (\d+) Kbps`,
+				Value:  "$2",
+				Labels: map[string]string{"path": "$1"},
+			},
+			want: []sample{{40000, "path=0"}, {0, "path=1"}},
+		},
+		{
+			name: "no match",
+			rule: config.RegexRule{Name: "ses", Regex: `SES:\s+(\d+)`},
+			want: nil,
+		},
+		{
+			name:        "value that is not a number",
+			rule:        config.RegexRule{Name: "status", Regex: `Status: (\w+)`},
+			want:        nil,
+			wantInvalid: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newTestExporter(config.Config{})
+			rules := newRegexRules(e.descs, []config.RegexRule{tt.rule}, func(name string) string {
+				return prometheus.BuildFQName(Namespace, SubsystemDsl, "raw_"+name)
+			}, "Test rule.", nil)
+
+			metrics := collect(func(metrics chan<- prometheus.Metric) {
+				e.collectRegexRules(rules, data, metrics)
+			})
+
+			var got []sample
+			for _, m := range metrics {
+				value, labels := sampleOf(t, m)
+				pairs := make([]string, 0, len(labels))
+				for name, v := range labels {
+					pairs = append(pairs, name+"="+v)
+				}
+				sort.Strings(pairs)
+
+				got = append(got, sample{value: value, labels: strings.Join(pairs, ",")})
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("samples = %v, want %v", got, tt.want)
+			}
+
+			invalid := collect(e.invalidSamples.Collect)
+			var total float64
+			for _, m := range invalid {
+				v, _ := sampleOf(t, m)
+				total += v
+			}
+			if total != tt.wantInvalid {
+				t.Errorf("invalid samples = %v, want %v", total, tt.wantInvalid)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/Dentrax/xdsl-exporter/internal/dsl"
+	"github.com/Dentrax/xdsl-exporter/internal/rtop"
+)
+
+// Error classes of failed polls.
+const (
+	errorClassTimeout = "timeout"
+	errorClassConnect = "connect"
+	errorClassNetwork = "network"
+	errorClassOther   = "other"
+)
+
+// pollStatus is the outcome of the last poll of a collector.
+type pollStatus struct {
+	up       bool
+	started  time.Time
+	duration time.Duration
+}
+
+// poll runs fn within the collector's deadline, records its outcome and logs
+// any error.
+func (e *Exporter) poll(ctx context.Context, collector string, timeout time.Duration, busy chan struct{}, fn func(ctx context.Context) error) error {
+	start := time.Now()
+	e.mu.Lock()
+	e.polling[collector] = start
+	e.mu.Unlock()
+
+	err := withDeadline(ctx, timeout, busy, fn)
+	duration := time.Since(start)
+
+	e.mu.Lock()
+	delete(e.polling, collector)
+	e.snapshot.polls[collector] = pollStatus{up: err == nil, started: start, duration: duration}
+	e.mu.Unlock()
+
+	if err != nil {
+		class := errorClass(err)
+		e.collectorErrors.WithLabelValues(collector, class).Inc()
+		if class == errorClassTimeout {
+			level.Warn(e.logger).Log("msg", "polling timed out", "collector", collector, "err", err.Error()) //nolint:errcheck
+		} else {
+			level.Error(e.logger).Log("msg", "could not get data", "collector", collector, "class", class, "err", err.Error()) //nolint:errcheck
+		}
+	}
+
+	return err
+}
+
+func (e *Exporter) collectPollStatus(collector string, status pollStatus, lastSuccess time.Time, metrics chan<- prometheus.Metric) {
+	metrics <- prometheus.MustNewConstMetric(e.collectorUp, prometheus.GaugeValue, boolToFloat64(status.up), collector)
+	metrics <- prometheus.MustNewConstMetric(e.collectorDuration, prometheus.GaugeValue, status.duration.Seconds(), collector)
+	if !lastSuccess.IsZero() {
+		metrics <- prometheus.MustNewConstMetric(e.lastSuccessfulPoll, prometheus.GaugeValue, float64(lastSuccess.UnixNano())/1e9, collector)
+	}
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// errorClass tells a modem that refuses the login apart from a session that
+// broke down and from a command that failed or could not be parsed.
+func errorClass(err error) string {
+	var dslConnectErr *dsl.ConnectError
+	var rtopConnectErr *rtop.ConnectError
+	var netErr net.Error
+
+	switch {
+	case isTimeout(err):
+		return errorClassTimeout
+	case errors.As(err, &dslConnectErr), errors.As(err, &rtopConnectErr):
+		return errorClassConnect
+	case errors.As(err, &netErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errorClassNetwork
+	default:
+		return errorClassOther
+	}
+}
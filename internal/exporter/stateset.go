@@ -0,0 +1,66 @@
+package exporter
+
+import (
+	"3e8.eu/go/dsl/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The values known to go-dsl, which are exposed as state sets: one series per
+// value, set to 1 for the current value and to 0 for all others. The unknown
+// values are left out, and nothing is exposed while the current value is
+// unknown.
+var (
+	dslStates = []models.State{
+		models.StateDown,
+		models.StateDownIdle,
+		models.StateDownSilent,
+		models.StateInit,
+		models.StateInitHandshake,
+		models.StateInitChannelDiscovery,
+		models.StateInitTraining,
+		models.StateInitChannelAnalysisExchange,
+		models.StateShowtime,
+		models.StateError,
+	}
+
+	dslModeTypes = []models.ModeType{
+		models.ModeTypeADSL,
+		models.ModeTypeADSL2,
+		models.ModeTypeADSL2Plus,
+		models.ModeTypeVDSL2,
+		models.ModeTypeGfast,
+	}
+
+	dslVectoringStates = []models.VectoringState{
+		models.VectoringStateOff,
+		models.VectoringStateFriendly,
+		models.VectoringStateFull,
+	}
+)
+
+func (e *Exporter) collectState(metrics chan<- prometheus.Metric, state models.State) {
+	if state == models.StateUnknown {
+		return
+	}
+	for _, s := range dslStates {
+		e.sample(metrics, e.state, prometheus.GaugeValue, boolToFloat64(s == state), s.String())
+	}
+}
+
+func (e *Exporter) collectModeType(metrics chan<- prometheus.Metric, mode models.ModeType) {
+	if mode == models.ModeTypeUnknown {
+		return
+	}
+	for _, m := range dslModeTypes {
+		e.sample(metrics, e.mode, prometheus.GaugeValue, boolToFloat64(m == mode), m.String())
+	}
+}
+
+func (e *Exporter) collectVectoringState(metrics chan<- prometheus.Metric, desc *prometheus.Desc, state models.VectoringValue) {
+	if !state.Valid || state.State == models.VectoringStateUnknown {
+		return
+	}
+	for _, s := range dslVectoringStates {
+		e.sample(metrics, desc, prometheus.GaugeValue, boolToFloat64(s == state.State), s.String())
+	}
+}
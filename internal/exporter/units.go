@@ -0,0 +1,27 @@
+package exporter
+
+import "math"
+
+// unitFactors converts the units reported by go-dsl to the base unit of the
+// metric, which is part of its name.
+var unitFactors = map[string]float64{
+	"bit/s":   1,
+	"kbit/s":  1e3,
+	"Mbit/s":  1e6,
+	"Gbit/s":  1e9,
+	"s":       1,
+	"ms":      1e-3,
+	"dB":      1,
+	"dBm":     1,
+	"symbols": 1,
+}
+
+// toBaseUnit converts value from the given unit to its base unit, returning
+// NaN for units it does not know, so that the sample is skipped.
+func toBaseUnit(value float64, unit string) float64 {
+	factor, ok := unitFactors[unit]
+	if !ok {
+		return math.NaN()
+	}
+	return value * factor
+}
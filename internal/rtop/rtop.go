@@ -1,24 +1,317 @@
 package rtop
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
 	"github.com/Dentrax/xdsl-exporter/internal/config"
+	"github.com/jpillora/backoff"
 	"github.com/rapidloop/rtop/pkg/client"
+	"github.com/rapidloop/rtop/pkg/types"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/errgroup"
 )
 
-func New(cfg config.Config) (*client.Client, error) {
-	opts := []client.Option{
-		client.WithUser(cfg.TargetUser),
-		client.WithHost(cfg.TargetHost),
-		client.WithPort(cfg.TargetPort),
-		client.WithKeyPath(cfg.TargetSSHKeyPath),
-		client.WithWorkers(2),
+// ConnectError is returned when the client could not connect to the modem.
+type ConnectError struct {
+	Err error
+}
+
+func (e *ConnectError) Error() string {
+	return "connect: " + e.Err.Error()
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// errClosed is returned by the requests of a closed client.
+var errClosed = errors.New("client is closed")
+
+// workers is the number of commands run on the modem at the same time.
+const workers = 2
+
+// Client is an rtop client that connects lazily on the first request, so the
+// exporter can start while the modem is still unreachable. Its SSH connection
+// also runs the commands of the config. A connection that broke down is torn
+// down and reconnected with an exponential backoff, like the session of the
+// DSL client.
+type Client struct {
+	cfg config.Config
+
+	// mu guards the connection only; commands run on it without holding
+	// the lock, so that a hung command does not block the others.
+	mu      sync.Mutex
+	conn    *ssh.Client
+	client  *client.Client
+	closed  bool
+	backoff *backoff.Backoff
+	retryAt time.Time
+}
+
+// Stat selects a part of the system stats. Only the commands needed for the
+// selected parts are run on the modem.
+type Stat uint
+
+const (
+	// StatHost selects the hostname, uptime and load.
+	StatHost Stat = 1 << iota
+	StatCPU
+	StatMem
+	StatFS
+	StatNet
+)
+
+// GetStats returns the selected parts of the system stats; the other parts are
+// left empty.
+func (c *Client) GetStats(stats Stat) (types.Stats, error) {
+	conn, client, err := c.connect()
+	if err != nil {
+		return types.Stats{}, err
+	}
+
+	s, err := getStats(client, stats)
+	if err != nil {
+		c.checkConn(conn, err)
+	}
+	return s, err
+}
+
+// Run runs the command on the modem and returns its standard output. The
+// command fails if it exits with a non-zero status. If it does not finish
+// within the timeout, its session is closed and the command is abandoned.
+func (c *Client) Run(command string, timeout time.Duration) ([]byte, error) {
+	conn, _, err := c.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := conn.NewSession()
+	if err != nil {
+		c.checkConn(conn, err)
+		return nil, fmt.Errorf("new session: %w", err)
+	}
+	defer session.Close()
+
+	var stdout bytes.Buffer
+	session.Stdout = &stdout
+
+	done := make(chan error, 1)
+	go func() { done <- session.Run(command) }()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			c.checkConn(conn, err)
+			return nil, fmt.Errorf("run %q: %w", command, err)
+		}
+		return stdout.Bytes(), nil
+	case <-timer.C:
+		_ = session.Signal(ssh.SIGKILL)
+		return nil, fmt.Errorf("run %q: %w", command, context.DeadlineExceeded)
+	}
+}
+
+// Close closes the SSH connection. Later requests fail without connecting
+// again.
+func (c *Client) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+		c.client = nil
+	}
+}
+
+// connect returns the SSH connection, opening it unless it is open already or
+// the client was closed.
+func (c *Client) connect() (*ssh.Client, *client.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil, nil, errClosed
+	}
+
+	if c.conn != nil {
+		return c.conn, c.client, nil
+	}
+
+	if wait := time.Until(c.retryAt); wait > 0 {
+		return nil, nil, &ConnectError{Err: fmt.Errorf("waiting %s before next attempt", wait.Round(time.Second))}
+	}
+
+	conn, err := dial(c.cfg)
+	if err != nil {
+		c.retryAt = time.Now().Add(c.backoff.Duration())
+		return nil, nil, &ConnectError{Err: err}
+	}
+
+	client, err := newClient(conn)
+	if err != nil {
+		conn.Close()
+		c.retryAt = time.Now().Add(c.backoff.Duration())
+		return nil, nil, &ConnectError{Err: err}
+	}
+
+	c.conn = conn
+	c.client = client
+	c.backoff.Reset()
+	c.retryAt = time.Time{}
+
+	return conn, client, nil
+}
+
+// checkConn tears down the connection if the error shows that it broke down,
+// e.g. because the modem rebooted. Errors of commands that leave the
+// connection intact do not cause a reconnect.
+func (c *Client) checkConn(conn *ssh.Client, err error) {
+	if !isSessionError(err) && alive(conn) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// The connection may have been replaced already by another request.
+	if c.conn != conn {
+		return
+	}
+	c.conn.Close()
+	c.conn = nil
+	c.client = nil
+	c.retryAt = time.Now().Add(c.backoff.Duration())
+}
+
+func isSessionError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || errors.As(err, &netErr)
+}
+
+// keepaliveTimeout bounds the check whether a connection is still alive.
+const keepaliveTimeout = 5 * time.Second
+
+// alive reports whether the modem still answers requests on the connection.
+// A reply that rejects the request counts as an answer.
+func alive(conn *ssh.Client) bool {
+	errc := make(chan error, 1)
+	go func() {
+		_, _, err := conn.SendRequest("keepalive@openssh.com", true, nil)
+		errc <- err
+	}()
+
+	timer := time.NewTimer(keepaliveTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-errc:
+		return err == nil
+	case <-timer.C:
+		return false
+	}
+}
+
+func getStats(c *client.Client, stats Stat) (types.Stats, error) {
+	var (
+		s       types.Stats
+		g       errgroup.Group
+		addrs   map[string]types.NetIPAddr
+		devices map[string]types.NetDevInfo
+	)
+	g.SetLimit(workers)
+
+	if stats&StatHost != 0 {
+		g.Go(func() (err error) { s.Hostname, err = c.GetHostname(); return })
+		g.Go(func() (err error) { s.Uptime, err = c.GetUptime(); return })
+		g.Go(func() (err error) { s.Loads, err = c.GetLoad(); return })
+	}
+	if stats&StatCPU != 0 {
+		g.Go(func() (err error) { s.CPU, err = c.GetCPU(); return })
+	}
+	if stats&StatMem != 0 {
+		g.Go(func() (err error) { s.MEM, err = c.GetMemInfo(); return })
+	}
+	if stats&StatFS != 0 {
+		g.Go(func() (err error) { s.FSInfos, err = c.GetFSInfos(); return })
+	}
+	if stats&StatNet != 0 {
+		g.Go(func() (err error) { addrs, err = c.GetNetIPAddrs(); return })
+		g.Go(func() (err error) { devices, err = c.GetNetDevInfos(); return })
+	}
+
+	err := g.Wait()
+	if stats&StatNet != 0 {
+		s.NetInterface = types.MergeNetInterfaces(addrs, devices)
 	}
 
-	client, err := client.New(opts...)
+	return s, err
+}
+
+// MergeStats copies the selected parts of src into dst, keeping the other
+// parts of dst.
+func MergeStats(dst *types.Stats, src types.Stats, stats Stat) {
+	if stats&StatHost != 0 {
+		dst.Hostname = src.Hostname
+		dst.Uptime = src.Uptime
+		dst.Loads = src.Loads
+	}
+	if stats&StatCPU != 0 {
+		dst.CPU = src.CPU
+	}
+	if stats&StatMem != 0 {
+		dst.MEM = src.MEM
+	}
+	if stats&StatFS != 0 {
+		dst.FSInfos = src.FSInfos
+	}
+	if stats&StatNet != 0 {
+		dst.NetInterface = src.NetInterface
+	}
+}
+
+// New returns a client for the target, or nil if rtop is disabled for it.
+func New(cfg config.Config) *Client {
+	if cfg.RtopDisabled {
+		return nil
+	}
+	return &Client{
+		cfg: cfg,
+		backoff: &backoff.Backoff{
+			Min:    cfg.ReconnectMinBackoff,
+			Max:    cfg.ReconnectMaxBackoff,
+			Factor: 2,
+			Jitter: true,
+		},
+	}
+}
+
+func newClient(conn *ssh.Client) (*client.Client, error) {
+	client, err := client.New(client.WithSSHClient(conn), client.WithWorkers(workers))
 	if err != nil {
 		return nil, fmt.Errorf("new rtop client: %w", err)
 	}
 
 	return client, nil
 }
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
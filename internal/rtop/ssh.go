@@ -0,0 +1,103 @@
+package rtop
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Dentrax/xdsl-exporter/internal/config"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// dialTimeout bounds the TCP connect and SSH handshake with the modem.
+const dialTimeout = 10 * time.Second
+
+// dial opens the SSH connection that is shared by the system stats and the
+// commands of the config. The host key of the modem is verified against the
+// known_hosts file, like that of the connection of go-dsl.
+func dial(cfg config.Config) (*ssh.Client, error) {
+	knownHostsPath, err := homedir.Expand(cfg.KnownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("get known_hosts: %w", err)
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("read known_hosts: %w", err)
+	}
+
+	auths, err := authMethods(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The agent is only needed for the handshake, so its socket is closed
+	// once the connection is established.
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if agentConn, err := net.Dial("unix", sock); err == nil {
+			defer agentConn.Close()
+			auths = append([]ssh.AuthMethod{ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers)}, auths...)
+		}
+	}
+
+	// The port of the target is that of go-dsl, e.g. a Telnet port, so
+	// rtop has a port of its own.
+	port := cfg.RtopPort
+	if port == 0 {
+		port = 22
+	}
+
+	return ssh.Dial("tcp", net.JoinHostPort(cfg.TargetHost, strconv.Itoa(port)), &ssh.ClientConfig{
+		User:            firstNonEmpty(cfg.RtopUser, cfg.TargetUser),
+		Auth:            auths,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         dialTimeout,
+	})
+}
+
+// authMethods returns the key and the password of the target, in that order,
+// as far as they are available.
+func authMethods(cfg config.Config) ([]ssh.AuthMethod, error) {
+	var auths []ssh.AuthMethod
+
+	if keyPath := firstNonEmpty(cfg.RtopSSHKeyPath, cfg.TargetSSHKeyPath); keyPath != "" {
+		signer, err := readSigner(keyPath, cfg.TargetSSHPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+
+	if cfg.TargetPassword != "" {
+		auths = append(auths, ssh.Password(cfg.TargetPassword))
+	}
+
+	return auths, nil
+}
+
+func readSigner(path, passphrase string) (ssh.Signer, error) {
+	expanded, err := homedir.Expand(path)
+	if err != nil {
+		return nil, fmt.Errorf("get ssh key: %w", err)
+	}
+
+	key, err := os.ReadFile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("read ssh key: %w", err)
+	}
+
+	var signer ssh.Signer
+	if passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse ssh key: %w", err)
+	}
+	return signer, nil
+}